@@ -0,0 +1,152 @@
+package gsort
+
+import (
+	"fmt"
+	"strings"
+	"unsafe"
+
+	"github.com/MatiasLyyra/fluid/gsort/internal/gl"
+)
+
+// InitGL loads the OpenGL functions used by gsort for the current context. Must be called after creating the context
+// and before creating any sorts. The functions are loaded from OpenGL ES 3.1 if the context is an OpenGL ES context,
+// and from OpenGL 4.3 otherwise. On OpenGL 4.3, initializing github.com/go-gl/gl/v4.3-core/gl is enough.
+func InitGL() error {
+	return gl.Init()
+}
+
+// Buffers and programs are managed with the GL functions available in both OpenGL 4.3 and OpenGL ES 3.1, as the compute
+// and shader storage buffer functions of raylib are only available with OpenGL 4.3.
+
+// loadBuffer creates shader storage buffer of size bytes initialized from data, or with zeros if data is nil.
+func loadBuffer(size uint32, data unsafe.Pointer) uint32 {
+	var buf uint32
+	gl.GenBuffers(1, &buf)
+	defer bindTarget(gl.SHADER_STORAGE_BUFFER, buf)()
+	if data == nil && size > 0 {
+		zeros := make([]byte, size)
+		data = unsafe.Pointer(unsafe.SliceData(zeros))
+	}
+	gl.BufferData(gl.SHADER_STORAGE_BUFFER, int(size), data, gl.DYNAMIC_COPY)
+	return buf
+}
+
+func unloadBuffer(buf uint32) {
+	gl.DeleteBuffers(1, &buf)
+}
+
+// updateBuffer writes size bytes of data to buf at offset in bytes.
+func updateBuffer(buf uint32, data unsafe.Pointer, size uint32, offset uint32) {
+	defer bindTarget(gl.SHADER_STORAGE_BUFFER, buf)()
+	gl.BufferSubData(gl.SHADER_STORAGE_BUFFER, int(offset), int(size), data)
+}
+
+// readBuffer reads size bytes from buf at offset in bytes to data. The buffer is mapped, as OpenGL ES cannot read
+// buffers with glGetBufferSubData.
+func readBuffer(buf uint32, data unsafe.Pointer, size uint32, offset uint32) {
+	if size == 0 {
+		return
+	}
+	defer bindTarget(gl.COPY_READ_BUFFER, buf)()
+	mapped := gl.MapBufferRange(gl.COPY_READ_BUFFER, int(offset), int(size), gl.MAP_READ_BIT)
+	if mapped == nil {
+		panic(fmt.Sprintf("failed to map buffer %d", buf))
+	}
+	copy(unsafe.Slice((*byte)(data), size), unsafe.Slice((*byte)(mapped), size))
+	gl.UnmapBuffer(gl.COPY_READ_BUFFER)
+}
+
+// readBufferWords reads the 32-bit words of buf at offsets in bytes to words, with a single mapping of the range
+// covering all of them.
+func readBufferWords(buf uint32, offsets []uint32, words []uint32) {
+	if len(offsets) == 0 {
+		return
+	}
+	low, high := offsets[0], offsets[0]
+	for _, offset := range offsets {
+		low = min(low, offset)
+		high = max(high, offset)
+	}
+	defer bindTarget(gl.COPY_READ_BUFFER, buf)()
+	mapped := gl.MapBufferRange(gl.COPY_READ_BUFFER, int(low), int(high-low+4), gl.MAP_READ_BIT)
+	if mapped == nil {
+		panic(fmt.Sprintf("failed to map buffer %d", buf))
+	}
+	for i, offset := range offsets {
+		words[i] = *(*uint32)(unsafe.Add(mapped, offset-low))
+	}
+	gl.UnmapBuffer(gl.COPY_READ_BUFFER)
+}
+
+// copyBuffer copies size bytes from src at srcOffset to dst at dstOffset.
+func copyBuffer(dst, src uint32, dstOffset, srcOffset, size uint32) {
+	defer bindTarget(gl.COPY_READ_BUFFER, src)()
+	defer bindTarget(gl.COPY_WRITE_BUFFER, dst)()
+	gl.CopyBufferSubData(gl.COPY_READ_BUFFER, gl.COPY_WRITE_BUFFER, int(srcOffset), int(dstOffset), int(size))
+}
+
+// bindingQueries are the queries of the buffers bound to the targets used by bindTarget.
+var bindingQueries = map[uint32]uint32{
+	gl.SHADER_STORAGE_BUFFER: gl.SHADER_STORAGE_BUFFER_BINDING,
+	gl.COPY_READ_BUFFER:      gl.COPY_READ_BUFFER_BINDING,
+	gl.COPY_WRITE_BUFFER:     gl.COPY_WRITE_BUFFER_BINDING,
+}
+
+// bindTarget binds buf to target and returns a function restoring the previous binding of target, so that buffers can
+// be loaded and read outside of the dispatches without changing the bindings of the host application.
+func bindTarget(target uint32, buf uint32) (restore func()) {
+	var previous int32
+	gl.GetIntegerv(bindingQueries[target], &previous)
+	gl.BindBuffer(target, buf)
+	return func() {
+		gl.BindBuffer(target, uint32(previous))
+	}
+}
+
+// bindBuffer binds buf to the shader storage buffer binding point index.
+func bindBuffer(buf uint32, index uint32) {
+	gl.BindBufferBase(gl.SHADER_STORAGE_BUFFER, index, buf)
+}
+
+// loadProgram compiles and links compute shader program from source. Panics with the info log if compiling or linking
+// fails.
+func loadProgram(name string, source string) uint32 {
+	shader := gl.CreateShader(gl.COMPUTE_SHADER)
+	defer gl.DeleteShader(shader)
+	sources, free := gl.Strs(source + "\x00")
+	length := int32(len(source))
+	gl.ShaderSource(shader, 1, sources, &length)
+	free()
+	gl.CompileShader(shader)
+	var status int32
+	gl.GetShaderiv(shader, gl.COMPILE_STATUS, &status)
+	if status == gl.FALSE {
+		panic(fmt.Sprintf("failed to compile shader %v: %v", name, infoLog(shader, gl.GetShaderiv, gl.GetShaderInfoLog)))
+	}
+
+	prog := gl.CreateProgram()
+	gl.AttachShader(prog, shader)
+	gl.LinkProgram(prog)
+	gl.GetProgramiv(prog, gl.LINK_STATUS, &status)
+	if status == gl.FALSE {
+		log := infoLog(prog, gl.GetProgramiv, gl.GetProgramInfoLog)
+		gl.DeleteProgram(prog)
+		panic(fmt.Sprintf("failed to link shader program %v: %v", name, log))
+	}
+	return prog
+}
+
+func infoLog(object uint32, get func(uint32, uint32, *int32), getLog func(uint32, int32, *int32, *uint8)) string {
+	var length int32
+	get(object, gl.INFO_LOG_LENGTH, &length)
+	if length == 0 {
+		return ""
+	}
+	log := make([]uint8, length)
+	getLog(object, length, nil, &log[0])
+	return strings.TrimRight(string(log), "\x00\n")
+}
+
+func uniformLocation(prog uint32, name string) int32 {
+	return gl.GetUniformLocation(prog, gl.Str(name+"\x00"))
+}
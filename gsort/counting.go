@@ -0,0 +1,191 @@
+package gsort
+
+import (
+	"github.com/MatiasLyyra/fluid/gsort/internal/gl"
+)
+
+// CountingSort sorts records with keys in the range [0, MaxKey), such as grid cell indices, with a counting sort.
+//
+// Instead of the 16 passes of RadixSort over 32-bit keys, the records are read only twice: once to build a histogram of
+// the keys with atomic counters, and once to scatter them to the offsets given by the prefix sum of the histogram.
+// The histogram is scanned with the same prefix sum as the block sums of RadixSort.
+type CountingSort struct {
+	shaderClear                         uint32
+	shaderClearUniformInput             int32
+	shaderHistogram                     uint32
+	shaderHistogramUniformInput         int32
+	shaderHistogramUniformMaxKey        int32
+	shaderHistogramUniformBlocks        int32
+	shaderHistogramUniformBlockSize     int32
+	shaderScatter                       uint32
+	shaderScatterUniformInput           int32
+	shaderScatterUniformMaxKey          int32
+	shaderStableScatter                 uint32
+	shaderStableScatterUniformInput     int32
+	shaderStableScatterUniformMaxKey    int32
+	shaderStableScatterUniformBlocks    int32
+	shaderStableScatterUniformBlockSize int32
+	offsets                             *prefixSum
+	outputBuffer                        uint32
+	maxKey                              uint32
+	// Records in each block with its own histogram in SortStable, and the count of blocks for the capacity.
+	stableBlockSize uint32
+	maxStableBlocks uint32
+	capacity        uint32
+	inputDataSize   uint32
+	workGroupSize   uint32
+}
+
+// NewCountingSort creates counting sort for at most settings.Capacity records with keys less than settings.MaxKey.
+func NewCountingSort(settings SortSettings) *CountingSort {
+	settings = settings.forDevice()
+	capacity := settings.getCapacity()
+	inputDataSize := settings.getInputDataSize()
+	maxKey := settings.getMaxKey()
+	internalSettings := settings.getShaderSettings()
+
+	clearProg := loadShader("shaders/clear.glsl", internalSettings)
+	histogramProg := loadShader("shaders/histogram.glsl", internalSettings)
+	scatterProg := loadShader("shaders/counting_scatter.glsl", internalSettings)
+	stableScatterProg := loadShader("shaders/stable_scatter.glsl", internalSettings)
+
+	maxStableBlocks := settings.getMaxStableBlocks()
+
+	return &CountingSort{
+		shaderClear:                         clearProg,
+		shaderClearUniformInput:             uniformLocation(clearProg, "n_input"),
+		shaderHistogram:                     histogramProg,
+		shaderHistogramUniformInput:         uniformLocation(histogramProg, "n_input"),
+		shaderHistogramUniformMaxKey:        uniformLocation(histogramProg, "max_key"),
+		shaderHistogramUniformBlocks:        uniformLocation(histogramProg, "n_blocks"),
+		shaderHistogramUniformBlockSize:     uniformLocation(histogramProg, "block_size"),
+		shaderScatter:                       scatterProg,
+		shaderScatterUniformInput:           uniformLocation(scatterProg, "n_input"),
+		shaderScatterUniformMaxKey:          uniformLocation(scatterProg, "max_key"),
+		shaderStableScatter:                 stableScatterProg,
+		shaderStableScatterUniformInput:     uniformLocation(stableScatterProg, "n_input"),
+		shaderStableScatterUniformMaxKey:    uniformLocation(stableScatterProg, "max_key"),
+		shaderStableScatterUniformBlocks:    uniformLocation(stableScatterProg, "n_blocks"),
+		shaderStableScatterUniformBlockSize: uniformLocation(stableScatterProg, "block_size"),
+		offsets:                             newPrefixSum(internalSettings, maxKey*maxStableBlocks),
+		outputBuffer:                        loadBuffer(capacity*inputDataSize, nil),
+		maxKey:                              maxKey,
+		stableBlockSize:                     settings.getStableBlockSize(),
+		maxStableBlocks:                     maxStableBlocks,
+		capacity:                            capacity,
+		inputDataSize:                       inputDataSize,
+		workGroupSize:                       internalSettings.WorkGroupSize,
+	}
+}
+
+// Sort sorts the first length records of input_buf by their key. Keys greater than or equal to MaxKey are sorted as if
+// they were MaxKey-1.
+//
+// The order of records with equal keys is not preserved, as records are scattered with atomic counters. Use SortStable
+// when the order matters.
+func (cs *CountingSort) Sort(input_buf uint32, length int) {
+	if length <= 0 {
+		return
+	}
+	if uint32(length) > cs.capacity {
+		panic("length exceeds the capacity of CountingSort")
+	}
+	defer saveState().restore()
+	dataLen := uint32(length)
+	workGroups := multipleOf(dataLen, cs.workGroupSize) / cs.workGroupSize
+
+	cs.histogram(input_buf, dataLen, 1, dataLen)
+	cs.offsets.scan(cs.maxKey)
+
+	gl.UseProgram(cs.shaderScatter)
+	gl.Uniform1ui(cs.shaderScatterUniformInput, dataLen)
+	gl.Uniform1ui(cs.shaderScatterUniformMaxKey, cs.maxKey)
+	bindBuffer(input_buf, 1)
+	bindBuffer(cs.outputBuffer, 2)
+	bindBuffer(cs.offsets.buffer, 3)
+	gl.DispatchCompute(workGroups, 1, 1)
+	gl.UseProgram(0)
+	cs.copyOutput(input_buf, dataLen)
+}
+
+// SortStable sorts the first length records of input_buf by their key, preserving the order of records with equal keys.
+// Keys greater than or equal to MaxKey are sorted as if they were MaxKey-1, as in Sort.
+//
+// The input is split into blocks of consecutive records, each with its own histogram. Histograms are laid out key by
+// key, so that their prefix sum gives the offset of each key in each block in the order of the blocks. A single work
+// group scatters each block in order, ranking records with equal keys within the block, which costs a pass over shared
+// memory per record compared to Sort.
+//
+// Blocks have StableBlockSize records, so the scatter runs on length / StableBlockSize work groups. The histograms take
+// 4 * MaxKey bytes per block, allocated for Capacity records when the sort is created; the default StableBlockSize is
+// raised until they fit the shader storage block size of the device, so with many keys and records the scatter may run
+// on few work groups.
+func (cs *CountingSort) SortStable(input_buf uint32, length int) {
+	if length <= 0 {
+		return
+	}
+	if uint32(length) > cs.capacity {
+		panic("length exceeds the capacity of CountingSort")
+	}
+	defer saveState().restore()
+	dataLen := uint32(length)
+	blocks := min(multipleOf(dataLen, cs.stableBlockSize)/cs.stableBlockSize, cs.maxStableBlocks)
+	blockSize := multipleOf(multipleOf(dataLen, blocks)/blocks, cs.workGroupSize)
+	// Rounding the block size up may leave the last blocks empty.
+	blocks = multipleOf(dataLen, blockSize) / blockSize
+
+	cs.histogram(input_buf, dataLen, blocks, blockSize)
+	cs.offsets.scan(cs.maxKey * blocks)
+
+	gl.UseProgram(cs.shaderStableScatter)
+	gl.Uniform1ui(cs.shaderStableScatterUniformInput, dataLen)
+	gl.Uniform1ui(cs.shaderStableScatterUniformMaxKey, cs.maxKey)
+	gl.Uniform1ui(cs.shaderStableScatterUniformBlocks, blocks)
+	gl.Uniform1ui(cs.shaderStableScatterUniformBlockSize, blockSize)
+	bindBuffer(input_buf, 1)
+	bindBuffer(cs.outputBuffer, 2)
+	bindBuffer(cs.offsets.buffer, 3)
+	gl.DispatchCompute(blocks, 1, 1)
+	gl.UseProgram(0)
+	cs.copyOutput(input_buf, dataLen)
+}
+
+// histogram counts the keys of the first dataLen records of buf for each block of blockSize records into the offsets.
+func (cs *CountingSort) histogram(buf uint32, dataLen uint32, blocks uint32, blockSize uint32) {
+	workGroups := multipleOf(dataLen, cs.workGroupSize) / cs.workGroupSize
+
+	counts := cs.maxKey * blocks
+	gl.UseProgram(cs.shaderClear)
+	gl.Uniform1ui(cs.shaderClearUniformInput, counts)
+	bindBuffer(cs.offsets.buffer, 1)
+	gl.DispatchCompute(min(multipleOf(counts, cs.workGroupSize)/cs.workGroupSize, maxWorkGroupCount), 1, 1)
+	gl.MemoryBarrier(gl.SHADER_STORAGE_BARRIER_BIT)
+
+	gl.UseProgram(cs.shaderHistogram)
+	gl.Uniform1ui(cs.shaderHistogramUniformInput, dataLen)
+	gl.Uniform1ui(cs.shaderHistogramUniformMaxKey, cs.maxKey)
+	gl.Uniform1ui(cs.shaderHistogramUniformBlocks, blocks)
+	gl.Uniform1ui(cs.shaderHistogramUniformBlockSize, blockSize)
+	bindBuffer(buf, 1)
+	bindBuffer(cs.offsets.buffer, 2)
+	gl.DispatchCompute(workGroups, 1, 1)
+	gl.UseProgram(0)
+	gl.MemoryBarrier(gl.SHADER_STORAGE_BARRIER_BIT)
+}
+
+// copyOutput copies the sorted records back to buf.
+func (cs *CountingSort) copyOutput(buf uint32, dataLen uint32) {
+	gl.MemoryBarrier(gl.BUFFER_UPDATE_BARRIER_BIT)
+	copyBuffer(buf, cs.outputBuffer, 0, 0, dataLen*cs.inputDataSize)
+	gl.MemoryBarrier(gl.SHADER_STORAGE_BARRIER_BIT)
+}
+
+func (cs *CountingSort) Free() {
+	gl.DeleteProgram(cs.shaderClear)
+	gl.DeleteProgram(cs.shaderHistogram)
+	gl.DeleteProgram(cs.shaderScatter)
+	gl.DeleteProgram(cs.shaderStableScatter)
+
+	cs.offsets.free()
+	unloadBuffer(cs.outputBuffer)
+}
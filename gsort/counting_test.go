@@ -0,0 +1,117 @@
+//go:build opengl43
+
+package gsort_test
+
+import (
+	"math/rand"
+	"slices"
+	"testing"
+
+	"github.com/MatiasLyyra/fluid/gsort"
+	rl "github.com/gen2brain/raylib-go/raylib"
+	"github.com/stretchr/testify/assert"
+)
+
+// countingRecords returns records of key and original index laid out as pairs of uint32 values.
+func countingRecords(r *rand.Rand, length int, maxKey uint32) []uint32 {
+	records := make([]uint32, 2*length)
+	for i := range length {
+		records[2*i] = r.Uint32() % maxKey
+		records[2*i+1] = uint32(i)
+	}
+	return records
+}
+
+// stableSortRecords sorts records of key and original index by key, preserving the order of equal keys.
+func stableSortRecords(records []uint32) []uint32 {
+	pairs := make([][2]uint32, len(records)/2)
+	for i := range pairs {
+		pairs[i] = [2]uint32{records[2*i], records[2*i+1]}
+	}
+	slices.SortStableFunc(pairs, func(a, b [2]uint32) int { return int(a[0]) - int(b[0]) })
+	sorted := make([]uint32, 0, len(records))
+	for _, pair := range pairs {
+		sorted = append(sorted, pair[0], pair[1])
+	}
+	return sorted
+}
+
+func TestCountingSort(t *testing.T) {
+	const capacity = 1 << 16
+	initialize(t)
+
+	r := rand.New(rand.NewSource(0))
+	for _, maxKey := range []uint32{1, 16, 1 << 14} {
+		cs := gsort.NewCountingSort(gsort.NewSettings(capacity).WithInputDataSize(8).WithMaxKey(maxKey))
+		sb := rl.LoadShaderBuffer(capacity*8, nil, rl.DynamicCopy)
+
+		for _, length := range []int{1, 255, 256, 257, 5000, capacity} {
+			records := countingRecords(r, length, maxKey)
+			expected := stableSortRecords(records)
+
+			writeBuffer(sb, records)
+			cs.Sort(sb, length)
+			actual := make([]uint32, 2*length)
+			readBuffer(sb, actual)
+			// Records with equal keys may be in any order.
+			for i := range length {
+				if actual[2*i] != expected[2*i] {
+					t.Fatalf("key differs at %d for max key %d and length %d, actual %d != %d expected", i, maxKey, length, actual[2*i], expected[2*i])
+				}
+			}
+			indices := make([]uint32, 0, length)
+			for i := range length {
+				indices = append(indices, actual[2*i+1])
+			}
+			slices.Sort(indices)
+			for i, index := range indices {
+				assert.Equal(t, uint32(i), index)
+			}
+
+			writeBuffer(sb, records)
+			cs.SortStable(sb, length)
+			readBuffer(sb, actual)
+			arraysEqual(t, expected, actual)
+		}
+		rl.UnloadShaderBuffer(sb)
+		cs.Free()
+	}
+}
+
+func TestCountingSortClampsKeys(t *testing.T) {
+	const capacity = 1 << 14
+	const maxKey = 64
+	initialize(t)
+
+	r := rand.New(rand.NewSource(0))
+	cs := gsort.NewCountingSort(gsort.NewSettings(capacity).WithInputDataSize(8).WithMaxKey(maxKey))
+	defer cs.Free()
+	sb := rl.LoadShaderBuffer(capacity*8, nil, rl.DynamicCopy)
+	defer rl.UnloadShaderBuffer(sb)
+
+	// Keys up to twice MaxKey, sorted as if the keys outside of the range were MaxKey-1.
+	records := countingRecords(r, capacity, 2*maxKey)
+	clamped := slices.Clone(records)
+	for i := 0; i < len(clamped); i += 2 {
+		clamped[i] = min(clamped[i], maxKey-1)
+	}
+	expected := stableSortRecords(clamped)
+	for i := 0; i < len(expected); i += 2 {
+		expected[i] = records[2*expected[i+1]]
+	}
+
+	actual := make([]uint32, 2*capacity)
+	writeBuffer(sb, records)
+	cs.Sort(sb, capacity)
+	readBuffer(sb, actual)
+	for i := range capacity {
+		if min(actual[2*i], maxKey-1) != min(expected[2*i], maxKey-1) {
+			t.Fatalf("key differs at %d, actual %d != %d expected", i, actual[2*i], expected[2*i])
+		}
+	}
+
+	writeBuffer(sb, records)
+	cs.SortStable(sb, capacity)
+	readBuffer(sb, actual)
+	arraysEqual(t, expected, actual)
+}
@@ -0,0 +1,195 @@
+package gsort
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"slices"
+	"sync"
+	"unsafe"
+
+	"github.com/MatiasLyyra/fluid/gsort/internal/gl"
+)
+
+// ErrExecutorClosed is returned by the futures of jobs submitted after Executor.Close.
+var ErrExecutorClosed = errors.New("gsort: executor closed")
+
+// Executor runs GL jobs submitted from any goroutine on the thread owning the GL context.
+//
+// Jobs are run in the order they are submitted, so a download submitted after a sort sees the sorted data without
+// waiting for the sort. Submitting never blocks, so jobs may submit more jobs, which are run after the jobs already
+// submitted. Futures must not be waited from a job, as the job would wait for itself.
+type Executor struct {
+	mu     sync.Mutex
+	jobs   []func()
+	closed bool
+	// ready has a value when jobs were submitted after Run last emptied the queue.
+	ready chan struct{}
+	quit  chan struct{}
+}
+
+// NewExecutor creates executor whose jobs are run by calling Run or Poll on the thread owning the GL context.
+func NewExecutor() *Executor {
+	return &Executor{
+		ready: make(chan struct{}, 1),
+		quit:  make(chan struct{}),
+	}
+}
+
+// StartExecutor starts executor on a new OS thread. init is called on the thread to create the GL context, after which
+// jobs are run on the thread until Close.
+func StartExecutor(init func() error) (*Executor, error) {
+	e := NewExecutor()
+	initErr := make(chan error)
+	go func() {
+		// Thread is never unlocked, so it is terminated together with the goroutine instead of running other goroutines
+		// with the GL context current.
+		runtime.LockOSThread()
+		if err := init(); err != nil {
+			initErr <- err
+			return
+		}
+		initErr <- nil
+		e.Run()
+	}()
+	if err := <-initErr; err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// Run runs jobs until Close. Must be called on the thread owning the GL context.
+func (e *Executor) Run() {
+	for {
+		e.Poll()
+		select {
+		case <-e.ready:
+		case <-e.quit:
+			// Jobs submitted before Close are still run.
+			e.Poll()
+			return
+		}
+	}
+}
+
+// Poll runs the jobs submitted so far without waiting for more, e.g. once per frame from the render loop. Jobs submitted
+// by the jobs are run too. Must be called on the thread owning the GL context.
+func (e *Executor) Poll() {
+	for {
+		e.mu.Lock()
+		jobs := e.jobs
+		e.jobs = nil
+		e.mu.Unlock()
+		if len(jobs) == 0 {
+			return
+		}
+		for _, job := range jobs {
+			job()
+		}
+	}
+}
+
+// Close stops Run after the jobs submitted so far. Jobs submitted after Close fail with ErrExecutorClosed.
+func (e *Executor) Close() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if !e.closed {
+		e.closed = true
+		close(e.quit)
+	}
+}
+
+// submit queues job, or returns false if the executor is closed.
+func (e *Executor) submit(job func()) bool {
+	e.mu.Lock()
+	if e.closed {
+		e.mu.Unlock()
+		return false
+	}
+	e.jobs = append(e.jobs, job)
+	e.mu.Unlock()
+	select {
+	case e.ready <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+// Future is the result of a job submitted to Executor.
+type Future[T any] struct {
+	done  chan struct{}
+	value T
+	err   error
+}
+
+// Done returns a channel closed when the job has finished.
+func (f *Future[T]) Done() <-chan struct{} {
+	return f.done
+}
+
+// Wait waits for the job to finish and returns its result. Panics of the job are returned as errors.
+func (f *Future[T]) Wait() (T, error) {
+	<-f.done
+	return f.value, f.err
+}
+
+// Do submits fn to be run on the GL thread.
+func Do[T any](e *Executor, fn func() T) *Future[T] {
+	f := &Future[T]{done: make(chan struct{})}
+	job := func() {
+		defer close(f.done)
+		defer func() {
+			if r := recover(); r != nil {
+				f.err = fmt.Errorf("gsort: job panicked: %v", r)
+			}
+		}()
+		f.value = fn()
+	}
+
+	if !e.submit(job) {
+		f.err = ErrExecutorClosed
+		close(f.done)
+	}
+	return f
+}
+
+// Sort submits sorting the first length records of buf with gs.
+func (e *Executor) Sort(gs *RadixSort, buf uint32, length int) *Future[struct{}] {
+	return Do(e, func() struct{} {
+		gs.Sort(buf, length)
+		return struct{}{}
+	})
+}
+
+// Upload submits writing data to buf at offset in bytes. Data is copied, so it can be modified before the job has run.
+func Upload[T any](e *Executor, buf uint32, data []T, offset uint32) *Future[struct{}] {
+	data = slices.Clone(data)
+	return Do(e, func() struct{} {
+		if len(data) == 0 {
+			return struct{}{}
+		}
+		var p runtime.Pinner
+		p.Pin(unsafe.SliceData(data))
+		defer p.Unpin()
+		size := uint32(len(data)) * uint32(unsafe.Sizeof(data[0]))
+		updateBuffer(buf, unsafe.Pointer(unsafe.SliceData(data)), size, offset)
+		return struct{}{}
+	})
+}
+
+// Download submits reading length values of type T from buf at offset in bytes.
+func Download[T any](e *Executor, buf uint32, length int, offset uint32) *Future[[]T] {
+	return Do(e, func() []T {
+		data := make([]T, length)
+		if length == 0 {
+			return data
+		}
+		var p runtime.Pinner
+		p.Pin(unsafe.SliceData(data))
+		defer p.Unpin()
+		size := uint32(length) * uint32(unsafe.Sizeof(data[0]))
+		gl.MemoryBarrier(gl.BUFFER_UPDATE_BARRIER_BIT)
+		readBuffer(buf, unsafe.Pointer(unsafe.SliceData(data)), size, offset)
+		return data
+	})
+}
@@ -0,0 +1,109 @@
+package gsort_test
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/MatiasLyyra/fluid/gsort"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExecutorRunsJobsInOrder(t *testing.T) {
+	e, err := gsort.StartExecutor(func() error { return nil })
+	assert.NoError(t, err)
+
+	var order []int
+	futures := make([]*gsort.Future[int], 100)
+	for i := range futures {
+		futures[i] = gsort.Do(e, func() int {
+			order = append(order, i)
+			return i * i
+		})
+	}
+	for i, f := range futures {
+		value, err := f.Wait()
+		assert.NoError(t, err)
+		assert.Equal(t, i*i, value)
+	}
+	e.Close()
+
+	for i := range order {
+		assert.Equal(t, i, order[i])
+	}
+}
+
+func TestExecutorFromGoroutines(t *testing.T) {
+	e := gsort.NewExecutor()
+
+	// Jobs are run on the calling goroutine, so the counter is not accessed concurrently.
+	counter := 0
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 100 {
+				_, err := gsort.Do(e, func() struct{} { counter++; return struct{}{} }).Wait()
+				assert.NoError(t, err)
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		e.Close()
+	}()
+	e.Run()
+
+	assert.Equal(t, 800, counter)
+}
+
+func TestExecutorErrors(t *testing.T) {
+	e, err := gsort.StartExecutor(func() error { return nil })
+	assert.NoError(t, err)
+
+	_, err = gsort.Do(e, func() int { panic("invalid settings") }).Wait()
+	assert.ErrorContains(t, err, "invalid settings")
+
+	// Executor keeps running after a job panics.
+	value, err := gsort.Do(e, func() int { return 1 }).Wait()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, value)
+
+	e.Close()
+	_, err = gsort.Do(e, func() int { return 1 }).Wait()
+	assert.ErrorIs(t, err, gsort.ErrExecutorClosed)
+
+	initErr := errors.New("no context")
+	_, err = gsort.StartExecutor(func() error { return initErr })
+	assert.ErrorIs(t, err, initErr)
+}
+
+func TestExecutorNestedSubmissions(t *testing.T) {
+	e, err := gsort.StartExecutor(func() error { return nil })
+	assert.NoError(t, err)
+	defer e.Close()
+
+	// Jobs submitting more jobs than fit any fixed queue must not block the GL thread.
+	var order []int
+	inner := make([]*gsort.Future[int], 0, 1000)
+	outer := gsort.Do(e, func() struct{} {
+		for i := range cap(inner) {
+			inner = append(inner, gsort.Do(e, func() int {
+				order = append(order, i)
+				return i
+			}))
+		}
+		return struct{}{}
+	})
+	_, err = outer.Wait()
+	assert.NoError(t, err)
+	for i, f := range inner {
+		value, err := f.Wait()
+		assert.NoError(t, err)
+		assert.Equal(t, i, value)
+	}
+	for i, value := range order {
+		assert.Equal(t, i, value)
+	}
+}
@@ -0,0 +1,16 @@
+package gsort
+
+import "strings"
+
+// RenderShaders renders every embedded shader for settings, as GLSL ES shaders if es is set.
+func RenderShaders(settings SortSettings, es bool) map[string]string {
+	internalSettings := settings.getSegmentShaderSettings()
+	internalSettings.ES = es
+	sources := map[string]string{}
+	for _, t := range shaderTemplate.Templates() {
+		if name := t.Name(); strings.HasPrefix(name, "shaders/") && name != "shaders/common.glsl" {
+			sources[name] = renderShader(name, internalSettings)
+		}
+	}
+	return sources
+}
@@ -0,0 +1,194 @@
+// Package gl is the subset of OpenGL used by gsort. Functions are bound to OpenGL 4.3 core by default. Init binds them
+// to OpenGL ES 3.1 instead when the current context is an OpenGL ES context, so the same binary runs on both. The
+// functions used exist in both APIs with the same signatures and enum values, so the rest of gsort is the same for both.
+package gl
+
+import (
+	"fmt"
+	"strings"
+
+	es "github.com/go-gl/gl/v3.1/gles2"
+	gl "github.com/go-gl/gl/v4.3-core/gl"
+)
+
+// Init loads the functions for the current context. The functions are loaded from OpenGL ES 3.1 if GL_VERSION of the
+// context starts with "OpenGL ES", and from OpenGL 4.3 otherwise.
+func Init() error {
+	if err := gl.Init(); err == nil && !isES(gl.GoStr(gl.GetString(gl.VERSION))) {
+		bindDesktop()
+		return nil
+	}
+	if err := es.Init(); err != nil {
+		return fmt.Errorf("failed to load OpenGL 4.3 or OpenGL ES 3.1 functions: %w", err)
+	}
+	if version := es.GoStr(es.GetString(es.VERSION)); !isES(version) {
+		return fmt.Errorf("failed to load OpenGL 4.3 functions for context version %v", version)
+	}
+	bindES()
+	return nil
+}
+
+// IsES reports whether the current context is an OpenGL ES context, which needs GLSL ES shaders.
+func IsES() bool {
+	return isES(GoStr(GetString(VERSION)))
+}
+
+func isES(version string) bool {
+	return strings.HasPrefix(version, "OpenGL ES")
+}
+
+var (
+	Str   = gl.Str
+	Strs  = gl.Strs
+	GoStr = gl.GoStr
+	Ptr   = gl.Ptr
+)
+
+var (
+	Finish = gl.Finish
+
+	GetString       = gl.GetString
+	GetIntegerv     = gl.GetIntegerv
+	GetIntegeri_v   = gl.GetIntegeri_v
+	GetInteger64v   = gl.GetInteger64v
+	GetInteger64i_v = gl.GetInteger64i_v
+
+	GenBuffers        = gl.GenBuffers
+	DeleteBuffers     = gl.DeleteBuffers
+	BindBuffer        = gl.BindBuffer
+	BindBufferBase    = gl.BindBufferBase
+	BindBufferRange   = gl.BindBufferRange
+	BufferData        = gl.BufferData
+	BufferSubData     = gl.BufferSubData
+	CopyBufferSubData = gl.CopyBufferSubData
+	MapBufferRange    = gl.MapBufferRange
+	UnmapBuffer       = gl.UnmapBuffer
+	MemoryBarrier     = gl.MemoryBarrier
+
+	CreateShader       = gl.CreateShader
+	ShaderSource       = gl.ShaderSource
+	CompileShader      = gl.CompileShader
+	GetShaderiv        = gl.GetShaderiv
+	GetShaderInfoLog   = gl.GetShaderInfoLog
+	DeleteShader       = gl.DeleteShader
+	CreateProgram      = gl.CreateProgram
+	AttachShader       = gl.AttachShader
+	LinkProgram        = gl.LinkProgram
+	GetProgramiv       = gl.GetProgramiv
+	GetProgramInfoLog  = gl.GetProgramInfoLog
+	DeleteProgram      = gl.DeleteProgram
+	UseProgram         = gl.UseProgram
+	GetUniformLocation = gl.GetUniformLocation
+	Uniform1ui         = gl.Uniform1ui
+	DispatchCompute    = gl.DispatchCompute
+)
+
+func bindDesktop() {
+	Finish = gl.Finish
+
+	GetString = gl.GetString
+	GetIntegerv = gl.GetIntegerv
+	GetIntegeri_v = gl.GetIntegeri_v
+	GetInteger64v = gl.GetInteger64v
+	GetInteger64i_v = gl.GetInteger64i_v
+
+	GenBuffers = gl.GenBuffers
+	DeleteBuffers = gl.DeleteBuffers
+	BindBuffer = gl.BindBuffer
+	BindBufferBase = gl.BindBufferBase
+	BindBufferRange = gl.BindBufferRange
+	BufferData = gl.BufferData
+	BufferSubData = gl.BufferSubData
+	CopyBufferSubData = gl.CopyBufferSubData
+	MapBufferRange = gl.MapBufferRange
+	UnmapBuffer = gl.UnmapBuffer
+	MemoryBarrier = gl.MemoryBarrier
+
+	CreateShader = gl.CreateShader
+	ShaderSource = gl.ShaderSource
+	CompileShader = gl.CompileShader
+	GetShaderiv = gl.GetShaderiv
+	GetShaderInfoLog = gl.GetShaderInfoLog
+	DeleteShader = gl.DeleteShader
+	CreateProgram = gl.CreateProgram
+	AttachShader = gl.AttachShader
+	LinkProgram = gl.LinkProgram
+	GetProgramiv = gl.GetProgramiv
+	GetProgramInfoLog = gl.GetProgramInfoLog
+	DeleteProgram = gl.DeleteProgram
+	UseProgram = gl.UseProgram
+	GetUniformLocation = gl.GetUniformLocation
+	Uniform1ui = gl.Uniform1ui
+	DispatchCompute = gl.DispatchCompute
+}
+
+func bindES() {
+	Finish = es.Finish
+
+	GetString = es.GetString
+	GetIntegerv = es.GetIntegerv
+	GetIntegeri_v = es.GetIntegeri_v
+	GetInteger64v = es.GetInteger64v
+	GetInteger64i_v = es.GetInteger64i_v
+
+	GenBuffers = es.GenBuffers
+	DeleteBuffers = es.DeleteBuffers
+	BindBuffer = es.BindBuffer
+	BindBufferBase = es.BindBufferBase
+	BindBufferRange = es.BindBufferRange
+	BufferData = es.BufferData
+	BufferSubData = es.BufferSubData
+	CopyBufferSubData = es.CopyBufferSubData
+	MapBufferRange = es.MapBufferRange
+	UnmapBuffer = es.UnmapBuffer
+	MemoryBarrier = es.MemoryBarrier
+
+	CreateShader = es.CreateShader
+	ShaderSource = es.ShaderSource
+	CompileShader = es.CompileShader
+	GetShaderiv = es.GetShaderiv
+	GetShaderInfoLog = es.GetShaderInfoLog
+	DeleteShader = es.DeleteShader
+	CreateProgram = es.CreateProgram
+	AttachShader = es.AttachShader
+	LinkProgram = es.LinkProgram
+	GetProgramiv = es.GetProgramiv
+	GetProgramInfoLog = es.GetProgramInfoLog
+	DeleteProgram = es.DeleteProgram
+	UseProgram = es.UseProgram
+	GetUniformLocation = es.GetUniformLocation
+	Uniform1ui = es.Uniform1ui
+	DispatchCompute = es.DispatchCompute
+}
+
+const (
+	FALSE = gl.FALSE
+
+	VERSION  = gl.VERSION
+	RENDERER = gl.RENDERER
+
+	MAX_COMPUTE_WORK_GROUP_INVOCATIONS = gl.MAX_COMPUTE_WORK_GROUP_INVOCATIONS
+	MAX_COMPUTE_WORK_GROUP_SIZE        = gl.MAX_COMPUTE_WORK_GROUP_SIZE
+	MAX_COMPUTE_SHARED_MEMORY_SIZE     = gl.MAX_COMPUTE_SHARED_MEMORY_SIZE
+	MAX_SHADER_STORAGE_BLOCK_SIZE      = gl.MAX_SHADER_STORAGE_BLOCK_SIZE
+
+	SHADER_STORAGE_BUFFER         = gl.SHADER_STORAGE_BUFFER
+	SHADER_STORAGE_BUFFER_BINDING = gl.SHADER_STORAGE_BUFFER_BINDING
+	SHADER_STORAGE_BUFFER_START   = gl.SHADER_STORAGE_BUFFER_START
+	SHADER_STORAGE_BUFFER_SIZE    = gl.SHADER_STORAGE_BUFFER_SIZE
+	COPY_READ_BUFFER              = gl.COPY_READ_BUFFER
+	COPY_READ_BUFFER_BINDING      = gl.COPY_READ_BUFFER_BINDING
+	COPY_WRITE_BUFFER             = gl.COPY_WRITE_BUFFER
+	COPY_WRITE_BUFFER_BINDING     = gl.COPY_WRITE_BUFFER_BINDING
+	DYNAMIC_COPY                  = gl.DYNAMIC_COPY
+	MAP_READ_BIT                  = gl.MAP_READ_BIT
+
+	SHADER_STORAGE_BARRIER_BIT = gl.SHADER_STORAGE_BARRIER_BIT
+	BUFFER_UPDATE_BARRIER_BIT  = gl.BUFFER_UPDATE_BARRIER_BIT
+
+	COMPUTE_SHADER  = gl.COMPUTE_SHADER
+	COMPILE_STATUS  = gl.COMPILE_STATUS
+	LINK_STATUS     = gl.LINK_STATUS
+	INFO_LOG_LENGTH = gl.INFO_LOG_LENGTH
+	CURRENT_PROGRAM = gl.CURRENT_PROGRAM
+)
@@ -0,0 +1,166 @@
+package gsort
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/MatiasLyyra/fluid/gsort/internal/gl"
+)
+
+// DeviceLimits are the compute limits of the current OpenGL context relevant to the sort settings.
+type DeviceLimits struct {
+	// GL_MAX_COMPUTE_WORK_GROUP_INVOCATIONS, limited by the first component of GL_MAX_COMPUTE_WORK_GROUP_SIZE.
+	MaxWorkGroupInvocations uint32
+	// GL_MAX_COMPUTE_SHARED_MEMORY_SIZE in bytes.
+	MaxSharedMemorySize uint32
+	// GL_MAX_SHADER_STORAGE_BLOCK_SIZE in bytes.
+	MaxStorageBlockSize uint64
+}
+
+// QueryDeviceLimits queries the limits of the current OpenGL context.
+func QueryDeviceLimits() DeviceLimits {
+	var invocations, sizeX, sharedMemory int32
+	var storageBlock int64
+	gl.GetIntegerv(gl.MAX_COMPUTE_WORK_GROUP_INVOCATIONS, &invocations)
+	gl.GetIntegeri_v(gl.MAX_COMPUTE_WORK_GROUP_SIZE, 0, &sizeX)
+	gl.GetIntegerv(gl.MAX_COMPUTE_SHARED_MEMORY_SIZE, &sharedMemory)
+	gl.GetInteger64v(gl.MAX_SHADER_STORAGE_BLOCK_SIZE, &storageBlock)
+	return DeviceLimits{
+		MaxWorkGroupInvocations: uint32(min(invocations, sizeX)),
+		MaxSharedMemorySize:     uint32(sharedMemory),
+		MaxStorageBlockSize:     uint64(storageBlock),
+	}
+}
+
+// ValidateFor checks that the work groups and buffers described by settings fit the limits. The error suggests the
+// largest valid value of the setting that does not fit, with the other settings unchanged. The default LocalSortSize is
+// reduced and the default StableBlockSize raised to fit the limits, so only explicit values of them can fail.
+func (settings SortSettings) ValidateFor(limits DeviceLimits) error {
+	settings = settings.withDeviceDefaults(limits)
+	valuesPerWorkGroup := settings.getValuesPerWorkGroup()
+	inputDataSize := settings.getInputDataSize()
+
+	if settings.fitsWorkGroup(limits) {
+		if lss, maxSize := settings.getLocalSortSize(), settings.maxLocalSortSize(limits); lss > maxSize {
+			if maxSize < valuesPerWorkGroup {
+				return fmt.Errorf("gsort: local sort of %d values needs %d bytes of shared memory, device supports %d; no LocalSortSize fits with ValuesPerWorkGroup %d",
+					lss, settings.localSortSharedMemory(), limits.MaxSharedMemorySize, valuesPerWorkGroup)
+			}
+			return fmt.Errorf("gsort: local sort of %d values needs %d bytes of shared memory, device supports %d; largest valid LocalSortSize is %d",
+				lss, settings.localSortSharedMemory(), limits.MaxSharedMemorySize, maxSize)
+		}
+	} else {
+		valid := uint32(0)
+		for v := valuesPerWorkGroup / 2; v >= settings.getItemsPerThread(); v /= 2 {
+			if candidate := settings.WithValuesPerWorkGroup(v); candidate.fitsWorkGroup(limits) {
+				valid = v
+				break
+			}
+		}
+		shader := settings.getShaderSettings()
+		if valid == 0 {
+			return fmt.Errorf("gsort: work groups of %d invocations using %d bytes of shared memory do not fit the device limits of %d invocations and %d bytes; no ValuesPerWorkGroup fits",
+				shader.WorkGroupSize, settings.radixSharedMemory(), limits.MaxWorkGroupInvocations, limits.MaxSharedMemorySize)
+		}
+		return fmt.Errorf("gsort: work groups of %d invocations using %d bytes of shared memory do not fit the device limits of %d invocations and %d bytes; largest valid ValuesPerWorkGroup is %d",
+			shader.WorkGroupSize, settings.radixSharedMemory(), limits.MaxWorkGroupInvocations, limits.MaxSharedMemorySize, valid)
+	}
+
+	if size := uint64(settings.getCapacity()) * uint64(inputDataSize); size > limits.MaxStorageBlockSize {
+		valid := limits.MaxStorageBlockSize / uint64(inputDataSize) / uint64(valuesPerWorkGroup) * uint64(valuesPerWorkGroup)
+		return fmt.Errorf("gsort: buffer of %d bytes exceeds the shader storage block size of %d bytes; largest valid Capacity is %d",
+			size, limits.MaxStorageBlockSize, valid)
+	}
+
+	if settings.MaxKey != 0 {
+		if counts := uint64(settings.MaxKey) * uint64(settings.getMaxStableBlocks()); counts > maxHistogramCounts(limits) {
+			minSize := settings.minStableBlockSize(limits)
+			if minSize == 0 {
+				return fmt.Errorf("gsort: histogram of %d keys exceeds the shader storage block size of %d bytes; no StableBlockSize fits with MaxKey %d",
+					settings.MaxKey, limits.MaxStorageBlockSize, settings.MaxKey)
+			}
+			return fmt.Errorf("gsort: histograms of %d bytes exceed the shader storage block size of %d bytes; smallest valid StableBlockSize is %d",
+				4*counts, limits.MaxStorageBlockSize, minSize)
+		}
+	}
+	return nil
+}
+
+// forDevice returns settings with the defaults depending on the limits of the current OpenGL context resolved. Panics if
+// settings do not fit the limits.
+func (settings SortSettings) forDevice() SortSettings {
+	limits := QueryDeviceLimits()
+	if err := settings.ValidateFor(limits); err != nil {
+		panic(err.Error())
+	}
+	return settings.withDeviceDefaults(limits)
+}
+
+// withDeviceDefaults returns settings with the default LocalSortSize reduced to the largest size fitting the shared
+// memory limit, and the default StableBlockSize raised to the smallest size fitting the storage block limit. If no size
+// fits, the setting is left to the default and fails validation.
+func (settings SortSettings) withDeviceDefaults(limits DeviceLimits) SortSettings {
+	if settings.LocalSortSize == 0 {
+		if maxSize := settings.maxLocalSortSize(limits); maxSize >= settings.getValuesPerWorkGroup() {
+			settings.LocalSortSize = min(settings.getLocalSortSize(), maxSize)
+		}
+	}
+	if settings.StableBlockSize == 0 && settings.MaxKey != 0 {
+		if minSize := settings.minStableBlockSize(limits); minSize != 0 {
+			settings.StableBlockSize = max(settings.getStableBlockSize(), minSize)
+		}
+	}
+	return settings
+}
+
+// fitsWorkGroup reports whether the work groups of the radix scan, scatter and prefix sum shaders fit the limits.
+func (settings SortSettings) fitsWorkGroup(limits DeviceLimits) bool {
+	return settings.getShaderSettings().WorkGroupSize <= limits.MaxWorkGroupInvocations &&
+		settings.radixSharedMemory() <= limits.MaxSharedMemorySize
+}
+
+// scanSharedMemory returns the bytes of shared memory used by the scan in common.glsl.
+func (settings SortSettings) scanSharedMemory() uint32 {
+	shader := settings.getShaderSettings()
+	padded := func(n uint32) uint32 { return n + n>>5 }
+	return 4 * (padded(shader.WorkGroupItems) + padded(shader.WorkGroupSize))
+}
+
+// radixSharedMemory returns the bytes of shared memory used by the radix scan and scatter shaders.
+func (settings SortSettings) radixSharedMemory() uint32 {
+	// Scatter shuffles a block of records, and keeps the count and start of each digit.
+	scatter := settings.getValuesPerWorkGroup()*settings.getInputDataSize() + 2*4*4
+	return max(settings.scanSharedMemory(), scatter)
+}
+
+// localSortSharedMemory returns the bytes of shared memory used by the local sort shader.
+func (settings SortSettings) localSortSharedMemory() uint32 {
+	// Key and index of each value, and the total of each digit.
+	return settings.scanSharedMemory() + 8*settings.getLocalSortSize() + 4*4
+}
+
+// maxLocalSortSize returns the largest LocalSortSize fitting the shared memory limit.
+func (settings SortSettings) maxLocalSortSize(limits DeviceLimits) uint32 {
+	valuesPerWorkGroup := settings.getValuesPerWorkGroup()
+	reserved := settings.scanSharedMemory() + 4*4
+	if limits.MaxSharedMemorySize < reserved {
+		return 0
+	}
+	return (limits.MaxSharedMemorySize - reserved) / 8 / valuesPerWorkGroup * valuesPerWorkGroup
+}
+
+// maxHistogramCounts returns the largest count of 32-bit counters in a shader storage block, also indexable by a uint.
+func maxHistogramCounts(limits DeviceLimits) uint64 {
+	return min(limits.MaxStorageBlockSize/4, math.MaxUint32)
+}
+
+// minStableBlockSize returns the smallest StableBlockSize with the histograms of all blocks fitting the storage block
+// limit, or 0 if not even a single histogram fits.
+func (settings SortSettings) minStableBlockSize(limits DeviceLimits) uint32 {
+	maxBlocks := min(maxHistogramCounts(limits)/uint64(settings.MaxKey), maxWorkGroupCount)
+	if maxBlocks == 0 {
+		return 0
+	}
+	capacity := uint64(settings.getCapacity())
+	return multipleOf(uint32((capacity+maxBlocks-1)/maxBlocks), settings.getShaderSettings().WorkGroupSize)
+}
@@ -0,0 +1,73 @@
+package gsort_test
+
+import (
+	"testing"
+
+	"github.com/MatiasLyyra/fluid/gsort"
+	"github.com/stretchr/testify/assert"
+)
+
+// minimumLimits are the smallest compute limits required by OpenGL 4.3, with a typical storage block size.
+var minimumLimits = gsort.DeviceLimits{
+	MaxWorkGroupInvocations: 1024,
+	MaxSharedMemorySize:     32768,
+	MaxStorageBlockSize:     1 << 31,
+}
+
+func TestValidateFor(t *testing.T) {
+	assert.NoError(t, gsort.NewSettings(1<<24).ValidateFor(minimumLimits))
+	assert.NoError(t, gsort.NewSettings(1<<24).WithValuesPerWorkGroup(2048).WithLocalSortSize(2048).ValidateFor(minimumLimits))
+	assert.NoError(t, gsort.NewSettings(1<<24).WithValuesPerWorkGroup(2048).WithItemsPerThread(8).WithLocalSortSize(2048).ValidateFor(minimumLimits))
+	// Default LocalSortSize of 4 * ValuesPerWorkGroup does not fit, so it is reduced to the largest size that does.
+	assert.NoError(t, gsort.NewSettings(1<<24).WithValuesPerWorkGroup(1024).ValidateFor(minimumLimits))
+	assert.NoError(t, gsort.NewSettings(1<<24).WithValuesPerWorkGroup(2048).ValidateFor(minimumLimits))
+	// Default StableBlockSize of 2048 does not fit the histograms, so it is raised to the smallest size that does.
+	assert.NoError(t, gsort.NewSettings(1<<24).WithMaxKey(1<<20).ValidateFor(minimumLimits))
+}
+
+func TestValidateForSuggestsLargestValidValue(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings gsort.SortSettings
+		expected string
+	}{
+		{
+			name:     "work group invocations",
+			settings: gsort.NewSettings(1 << 20).WithValuesPerWorkGroup(4096),
+			expected: "largest valid ValuesPerWorkGroup is 2048",
+		},
+		{
+			name:     "scatter shared memory",
+			settings: gsort.NewSettings(1 << 20).WithValuesPerWorkGroup(1024).WithInputDataSize(64),
+			expected: "largest valid ValuesPerWorkGroup is 256",
+		},
+		{
+			name:     "local sort shared memory",
+			settings: gsort.NewSettings(1 << 20).WithLocalSortSize(8192),
+			expected: "largest valid LocalSortSize is 3840",
+		},
+		{
+			name:     "storage block size",
+			settings: gsort.NewSettings(1 << 30),
+			expected: "largest valid Capacity is 536870912",
+		},
+		{
+			name:     "stable histograms",
+			settings: gsort.NewSettings(1 << 24).WithMaxKey(1 << 20).WithStableBlockSize(2048),
+			expected: "smallest valid StableBlockSize is 32768",
+		},
+		{
+			name:     "single histogram",
+			settings: gsort.NewSettings(1 << 24).WithMaxKey(1 << 30),
+			expected: "no StableBlockSize fits with MaxKey 1073741824",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.settings.ValidateFor(minimumLimits)
+			if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), test.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package gsort
+
+import (
+	"github.com/MatiasLyyra/fluid/gsort/internal/gl"
+)
+
+// prefixSum calculates exclusive prefix sum of arbitrarily large uint32 array stored at the beginning of its buffer.
+//
+// The array is scanned in blocks of valuesPerWorkGroup values. Sum of each block is stored after the array and scanned
+// recursively, after which the scanned block sums are added back to the blocks.
+type prefixSum struct {
+	shaderPrefixSum                   uint32
+	shaderPrefixSumUniformInput       int32
+	shaderPrefixSumUniformInputOffset int32
+	shaderPrefixSumUniformSumOffset   int32
+	shaderAddBlock                    uint32
+	shaderAddBlockUniformInputOffset  int32
+	shaderAddBlockUniformSumOffset    int32
+	buffer                            uint32
+	valuesPerWorkGroup                uint32
+}
+
+// newPrefixSum creates prefix sum with a buffer large enough to scan capacity values.
+func newPrefixSum(settings shaderSettings, capacity uint32) *prefixSum {
+	valuesPerWorkGroup := settings.WorkGroupItems
+
+	prefixSumProg := loadShader("shaders/prefix_sum.glsl", settings)
+	addBlockProg := loadShader("shaders/add_block.glsl", settings)
+
+	// Each level of block sums is valuesPerWorkGroup times smaller than the previous one, so all levels fit in twice the size of
+	// the first level. The last level is always scanned by a full work group.
+	initialSize := nextPow2(multipleOf(max(capacity, 1), valuesPerWorkGroup))
+	buffer := loadBuffer((2*initialSize+valuesPerWorkGroup)*4, nil)
+
+	return &prefixSum{
+		shaderPrefixSum:                   prefixSumProg,
+		shaderPrefixSumUniformInput:       uniformLocation(prefixSumProg, "n_input"),
+		shaderPrefixSumUniformInputOffset: uniformLocation(prefixSumProg, "input_offset"),
+		shaderPrefixSumUniformSumOffset:   uniformLocation(prefixSumProg, "sum_offset"),
+		shaderAddBlock:                    addBlockProg,
+		shaderAddBlockUniformInputOffset:  uniformLocation(addBlockProg, "input_offset"),
+		shaderAddBlockUniformSumOffset:    uniformLocation(addBlockProg, "sum_offset"),
+		buffer:                            buffer,
+		valuesPerWorkGroup:                valuesPerWorkGroup,
+	}
+}
+
+// scan replaces the first count values of the buffer with their exclusive prefix sum.
+func (ps *prefixSum) scan(count uint32) {
+	initialSize := nextPow2(multipleOf(count, ps.valuesPerWorkGroup))
+	sumBufferSize := initialSize
+	sumBufferOffset := uint32(0)
+	sumBufferSumOffset := sumBufferSize
+	inputDataSize := count
+
+	for sumBufferSize >= ps.valuesPerWorkGroup {
+		ps.prefixSumIteration(sumBufferSize, sumBufferOffset, sumBufferSumOffset, inputDataSize)
+		sumBufferOffset += sumBufferSize
+		sumBufferSumOffset = sumBufferOffset + (sumBufferSize / ps.valuesPerWorkGroup)
+		sumBufferSize /= ps.valuesPerWorkGroup
+		inputDataSize = sumBufferSize
+	}
+	if initialSize <= ps.valuesPerWorkGroup {
+		return
+	}
+	ps.prefixSumIteration(sumBufferSize, sumBufferOffset, sumBufferSumOffset, sumBufferSize)
+	sumBufferSize *= ps.valuesPerWorkGroup
+	sumBufferOffset -= sumBufferSize
+	sumBufferSumOffset = sumBufferOffset + (sumBufferSize)
+
+	for sumBufferSize <= initialSize {
+		ps.addBlockIteration(sumBufferSize, sumBufferOffset, sumBufferSumOffset)
+		sumBufferSize *= ps.valuesPerWorkGroup
+		sumBufferOffset -= sumBufferSize
+		sumBufferSumOffset = sumBufferOffset + (sumBufferSize)
+	}
+}
+
+func (ps *prefixSum) prefixSumIteration(sumBufferSize uint32, sumBufferOffset uint32, sumBufferSumOffset uint32, dataLenth uint32) {
+	gl.UseProgram(ps.shaderPrefixSum)
+	gl.Uniform1ui(ps.shaderPrefixSumUniformInput, dataLenth)
+	gl.Uniform1ui(ps.shaderPrefixSumUniformInputOffset, sumBufferOffset)
+	gl.Uniform1ui(ps.shaderPrefixSumUniformSumOffset, sumBufferSumOffset)
+	bindBuffer(ps.buffer, 1)
+	gl.DispatchCompute(max(sumBufferSize/ps.valuesPerWorkGroup, 1), 1, 1)
+	gl.UseProgram(0)
+	gl.MemoryBarrier(gl.SHADER_STORAGE_BARRIER_BIT)
+}
+
+func (ps *prefixSum) addBlockIteration(sumBufferSize uint32, sumBufferOffset uint32, sumBufferSumOffset uint32) {
+	gl.UseProgram(ps.shaderAddBlock)
+	gl.Uniform1ui(ps.shaderAddBlockUniformInputOffset, sumBufferOffset)
+	gl.Uniform1ui(ps.shaderAddBlockUniformSumOffset, sumBufferSumOffset)
+	bindBuffer(ps.buffer, 1)
+	gl.DispatchCompute(max(sumBufferSize/ps.valuesPerWorkGroup, 1), 1, 1)
+	gl.UseProgram(0)
+	gl.MemoryBarrier(gl.SHADER_STORAGE_BARRIER_BIT)
+}
+
+func (ps *prefixSum) free() {
+	gl.DeleteProgram(ps.shaderPrefixSum)
+	gl.DeleteProgram(ps.shaderAddBlock)
+	unloadBuffer(ps.buffer)
+}
@@ -0,0 +1,136 @@
+package gsort
+
+import (
+	"runtime"
+	"unsafe"
+
+	"github.com/MatiasLyyra/fluid/gsort/internal/gl"
+)
+
+// RunLengthEncoder finds runs of equal keys in sorted buffers, such as the occupied grid cells and the particle count
+// in each cell after sorting particles by their cell.
+type RunLengthEncoder struct {
+	shaderHeadFlags             uint32
+	shaderHeadFlagsUniformInput int32
+	shaderCompact               uint32
+	shaderCompactUniformInput   int32
+	shaderCounts                uint32
+	shaderCountsUniformRuns     int32
+	runIndices                  *prefixSum
+	runStartsBuffer             uint32
+	uniqueKeysBuffer            uint32
+	countsBuffer                uint32
+	capacity                    uint32
+	workGroupSize               uint32
+}
+
+// NewRunLengthEncoder creates run-length encoder for at most settings.Capacity records laid out as described by settings.
+// Panics if settings do not fit the limits of the current OpenGL context, see SortSettings.ValidateFor.
+func NewRunLengthEncoder(settings SortSettings) *RunLengthEncoder {
+	settings = settings.forDevice()
+	capacity := settings.getCapacity()
+	internalSettings := settings.getShaderSettings()
+
+	headFlagsProg := loadShader("shaders/head_flags.glsl", internalSettings)
+	compactProg := loadShader("shaders/rle_compact.glsl", internalSettings)
+	countsProg := loadShader("shaders/rle_counts.glsl", internalSettings)
+
+	// Head flags are calculated for one position past the input, which makes the total count of runs and the end of the
+	// last run available without special cases.
+	runIndices := newPrefixSum(internalSettings, capacity+1)
+	runStarts := loadBuffer((capacity+1)*4, nil)
+	uniqueKeys := loadBuffer(capacity*4, nil)
+	counts := loadBuffer(capacity*4, nil)
+
+	return &RunLengthEncoder{
+		shaderHeadFlags:             headFlagsProg,
+		shaderHeadFlagsUniformInput: uniformLocation(headFlagsProg, "n_input"),
+		shaderCompact:               compactProg,
+		shaderCompactUniformInput:   uniformLocation(compactProg, "n_input"),
+		shaderCounts:                countsProg,
+		shaderCountsUniformRuns:     uniformLocation(countsProg, "n_runs"),
+		runIndices:                  runIndices,
+		runStartsBuffer:             runStarts,
+		uniqueKeysBuffer:            uniqueKeys,
+		countsBuffer:                counts,
+		capacity:                    capacity,
+		workGroupSize:               internalSettings.WorkGroupSize,
+	}
+}
+
+// RunLengthEncode finds runs of equal keys in sorted_buf. Unique keys of the runs and the count of records in each run are
+// written to uint32 buffers owned by the encoder, which stay valid until the next call or Free.
+//
+// Head flag is calculated for each record, which is then prefix summed to get the index of the run each record belongs to.
+func (rle *RunLengthEncoder) RunLengthEncode(sorted_buf uint32, length int) (uniqueKeys uint32, counts uint32, numRuns int) {
+	if length <= 0 {
+		return rle.uniqueKeysBuffer, rle.countsBuffer, 0
+	}
+	if uint32(length) > rle.capacity {
+		panic("length exceeds the capacity of RunLengthEncoder")
+	}
+	defer saveState().restore()
+	dataLen := uint32(length)
+	workGroups := multipleOf(dataLen+1, rle.workGroupSize) / rle.workGroupSize
+
+	gl.UseProgram(rle.shaderHeadFlags)
+	gl.Uniform1ui(rle.shaderHeadFlagsUniformInput, dataLen)
+	bindBuffer(sorted_buf, 1)
+	bindBuffer(rle.runIndices.buffer, 2)
+	gl.DispatchCompute(workGroups, 1, 1)
+	gl.UseProgram(0)
+	gl.MemoryBarrier(gl.SHADER_STORAGE_BARRIER_BIT)
+
+	rle.runIndices.scan(dataLen + 1)
+
+	gl.UseProgram(rle.shaderCompact)
+	gl.Uniform1ui(rle.shaderCompactUniformInput, dataLen)
+	bindBuffer(sorted_buf, 1)
+	bindBuffer(rle.runIndices.buffer, 2)
+	bindBuffer(rle.uniqueKeysBuffer, 3)
+	bindBuffer(rle.runStartsBuffer, 4)
+	gl.DispatchCompute(workGroups, 1, 1)
+	gl.UseProgram(0)
+	gl.MemoryBarrier(gl.SHADER_STORAGE_BARRIER_BIT)
+
+	// Run index of the position past the input is the count of runs.
+	gl.MemoryBarrier(gl.BUFFER_UPDATE_BARRIER_BIT)
+	var runs uint32
+	var p runtime.Pinner
+	p.Pin(&runs)
+	readBuffer(rle.runIndices.buffer, unsafe.Pointer(&runs), 4, dataLen*4)
+	p.Unpin()
+
+	gl.UseProgram(rle.shaderCounts)
+	gl.Uniform1ui(rle.shaderCountsUniformRuns, runs)
+	bindBuffer(rle.runStartsBuffer, 1)
+	bindBuffer(rle.countsBuffer, 2)
+	gl.DispatchCompute(multipleOf(runs, rle.workGroupSize)/rle.workGroupSize, 1, 1)
+	gl.UseProgram(0)
+	gl.MemoryBarrier(gl.SHADER_STORAGE_BARRIER_BIT)
+
+	return rle.uniqueKeysBuffer, rle.countsBuffer, int(runs)
+}
+
+func (rle *RunLengthEncoder) Free() {
+	gl.DeleteProgram(rle.shaderHeadFlags)
+	gl.DeleteProgram(rle.shaderCompact)
+	gl.DeleteProgram(rle.shaderCounts)
+
+	rle.runIndices.free()
+	unloadBuffer(rle.runStartsBuffer)
+	unloadBuffer(rle.uniqueKeysBuffer)
+	unloadBuffer(rle.countsBuffer)
+}
+
+// RunLengthEncodeCPU is the CPU equivalent of RunLengthEncoder.RunLengthEncode for sorted keys.
+func RunLengthEncodeCPU(keys []uint32) (uniqueKeys []uint32, counts []uint32) {
+	for i, key := range keys {
+		if i == 0 || key != keys[i-1] {
+			uniqueKeys = append(uniqueKeys, key)
+			counts = append(counts, 0)
+		}
+		counts[len(counts)-1]++
+	}
+	return uniqueKeys, counts
+}
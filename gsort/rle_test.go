@@ -0,0 +1,58 @@
+//go:build opengl43
+
+package gsort_test
+
+import (
+	"math/rand"
+	"slices"
+	"testing"
+
+	"github.com/MatiasLyyra/fluid/gsort"
+	rl "github.com/gen2brain/raylib-go/raylib"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunLengthEncodeCPU(t *testing.T) {
+	uniqueKeys, counts := gsort.RunLengthEncodeCPU([]uint32{1, 1, 2, 5, 5, 5, 9})
+	assert.Equal(t, []uint32{1, 2, 5, 9}, uniqueKeys)
+	assert.Equal(t, []uint32{2, 1, 3, 1}, counts)
+
+	uniqueKeys, counts = gsort.RunLengthEncodeCPU(nil)
+	assert.Empty(t, uniqueKeys)
+	assert.Empty(t, counts)
+}
+
+func TestRunLengthEncode(t *testing.T) {
+	const capacity = 1 << 16
+	initialize(t)
+
+	r := rand.New(rand.NewSource(0))
+	rle := gsort.NewRunLengthEncoder(gsort.NewSettings(capacity))
+	defer rle.Free()
+
+	sb := rl.LoadShaderBuffer(capacity*4, nil, rl.DynamicCopy)
+	defer rl.UnloadShaderBuffer(sb)
+
+	for _, length := range []int{1, 2, 255, 256, 257, capacity} {
+		for _, keyRange := range []uint32{1, 16, 1 << 31} {
+			keys := make([]uint32, length)
+			for i := range keys {
+				keys[i] = r.Uint32() % keyRange
+			}
+			slices.Sort(keys)
+			expectedKeys, expectedCounts := gsort.RunLengthEncodeCPU(keys)
+
+			writeBuffer(sb, keys)
+			uniqueKeysBuf, countsBuf, numRuns := rle.RunLengthEncode(sb, length)
+			if numRuns != len(expectedKeys) {
+				t.Fatalf("run count differs for length %d, actual %d != %d expected", length, numRuns, len(expectedKeys))
+			}
+			uniqueKeys := make([]uint32, numRuns)
+			counts := make([]uint32, numRuns)
+			readBuffer(uniqueKeysBuf, uniqueKeys)
+			readBuffer(countsBuf, counts)
+			arraysEqual(t, expectedKeys, uniqueKeys)
+			arraysEqual(t, expectedCounts, counts)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package gsort
+
+import (
+	"github.com/MatiasLyyra/fluid/gsort/internal/gl"
+)
+
+// BinarySearch runs batched binary searches over a buffer sorted by RadixSort.
+// Each query is searched by its own invocation, so large query batches are handled by a single dispatch.
+type BinarySearch struct {
+	shaderSearch                  uint32
+	shaderSearchUniformInput      int32
+	shaderSearchUniformQueries    int32
+	shaderSearchUniformUpperBound int32
+	workGroupSize                 uint32
+}
+
+// NewSearch creates binary search for records laid out as described by settings.
+// Capacity of the settings is not used, as the search does not need internal buffers. Panics if settings do not fit the
+// limits of the current OpenGL context, see SortSettings.ValidateFor.
+func NewSearch(settings SortSettings) *BinarySearch {
+	settings = settings.forDevice()
+	internalSettings := settings.getShaderSettings()
+	searchProg := loadShader("shaders/search.glsl", internalSettings)
+	return &BinarySearch{
+		shaderSearch:                  searchProg,
+		shaderSearchUniformInput:      uniformLocation(searchProg, "n_input"),
+		shaderSearchUniformQueries:    uniformLocation(searchProg, "n_queries"),
+		shaderSearchUniformUpperBound: uniformLocation(searchProg, "upper_bound"),
+		workGroupSize:                 internalSettings.WorkGroupSize,
+	}
+}
+
+// LowerBound writes for each uint32 key in query_buf the index of the first record in sorted_buf with key >= query to output_buf.
+// If no such record exists, length is written.
+func (bs *BinarySearch) LowerBound(sorted_buf uint32, length int, query_buf uint32, queries int, output_buf uint32) {
+	bs.search(sorted_buf, length, query_buf, queries, output_buf, false)
+}
+
+// UpperBound writes for each uint32 key in query_buf the index of the first record in sorted_buf with key > query to output_buf.
+// If no such record exists, length is written.
+func (bs *BinarySearch) UpperBound(sorted_buf uint32, length int, query_buf uint32, queries int, output_buf uint32) {
+	bs.search(sorted_buf, length, query_buf, queries, output_buf, true)
+}
+
+func (bs *BinarySearch) search(sorted_buf uint32, length int, query_buf uint32, queries int, output_buf uint32, upper bool) {
+	if queries <= 0 {
+		return
+	}
+	defer saveState().restore()
+	var upperBound uint32
+	if upper {
+		upperBound = 1
+	}
+	workGroups := multipleOf(uint32(queries), bs.workGroupSize) / bs.workGroupSize
+
+	gl.UseProgram(bs.shaderSearch)
+	gl.Uniform1ui(bs.shaderSearchUniformInput, uint32(max(length, 0)))
+	gl.Uniform1ui(bs.shaderSearchUniformQueries, uint32(queries))
+	gl.Uniform1ui(bs.shaderSearchUniformUpperBound, upperBound)
+	bindBuffer(sorted_buf, 1)
+	bindBuffer(query_buf, 2)
+	bindBuffer(output_buf, 3)
+	gl.DispatchCompute(workGroups, 1, 1)
+	gl.UseProgram(0)
+	gl.MemoryBarrier(gl.SHADER_STORAGE_BARRIER_BIT)
+}
+
+func (bs *BinarySearch) Free() {
+	gl.DeleteProgram(bs.shaderSearch)
+}
@@ -0,0 +1,127 @@
+//go:build opengl43
+
+package gsort_test
+
+import (
+	"math/rand"
+	"runtime"
+	"slices"
+	"sort"
+	"testing"
+	"unsafe"
+
+	"github.com/MatiasLyyra/fluid/gsort"
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+func TestSearchBounds(t *testing.T) {
+	const capacity = 1 << 16
+	const queryCount = 4096
+	initialize(t)
+
+	r := rand.New(rand.NewSource(0))
+	bs := gsort.NewSearch(gsort.NewSettings(capacity))
+	defer bs.Free()
+
+	sb := rl.LoadShaderBuffer(capacity*4, nil, rl.DynamicCopy)
+	defer rl.UnloadShaderBuffer(sb)
+	qb := rl.LoadShaderBuffer(queryCount*4, nil, rl.DynamicCopy)
+	defer rl.UnloadShaderBuffer(qb)
+	ob := rl.LoadShaderBuffer(queryCount*4, nil, rl.DynamicCopy)
+	defer rl.UnloadShaderBuffer(ob)
+
+	for _, length := range []int{0, 1, 255, 256, capacity} {
+		keys := make([]uint32, length)
+		for i := range keys {
+			keys[i] = r.Uint32() % 8192
+		}
+		slices.Sort(keys)
+		queries := make([]uint32, queryCount)
+		for i := range queries {
+			queries[i] = r.Uint32() % 8200
+		}
+		expectedLower := make([]uint32, queryCount)
+		expectedUpper := make([]uint32, queryCount)
+		for i, q := range queries {
+			expectedLower[i] = uint32(sort.Search(length, func(j int) bool { return keys[j] >= q }))
+			expectedUpper[i] = uint32(sort.Search(length, func(j int) bool { return keys[j] > q }))
+		}
+
+		var p runtime.Pinner
+		if length > 0 {
+			p.Pin(unsafe.SliceData(keys))
+			rl.UpdateShaderBuffer(sb, unsafe.Pointer(unsafe.SliceData(keys)), uint32(length*4), 0)
+		}
+		p.Pin(unsafe.SliceData(queries))
+		rl.UpdateShaderBuffer(qb, unsafe.Pointer(unsafe.SliceData(queries)), queryCount*4, 0)
+		p.Unpin()
+
+		actual := make([]uint32, queryCount)
+		bs.LowerBound(sb, length, qb, queryCount, ob)
+		readBuffer(ob, actual)
+		arraysEqual(t, expectedLower, actual)
+
+		bs.UpperBound(sb, length, qb, queryCount, ob)
+		readBuffer(ob, actual)
+		arraysEqual(t, expectedUpper, actual)
+	}
+}
+
+func TestSearchPaddedRecords(t *testing.T) {
+	type TestData struct {
+		data1 uint32
+		key   uint32
+		data2 uint32
+	}
+	const capacity = 1 << 12
+	initialize(t)
+
+	r := rand.New(rand.NewSource(0))
+	bs := gsort.NewSearch(gsort.NewSettings(capacity).WithKeyOffset(4).WithInputDataSize(12))
+	defer bs.Free()
+
+	records := make([]TestData, capacity)
+	for i := range records {
+		records[i] = TestData{data1: r.Uint32(), key: uint32(i / 4), data2: r.Uint32()}
+	}
+	queries := []uint32{0, 1, 7, capacity/4 - 1, capacity / 4}
+	expectedLower := []uint32{0, 4, 28, capacity - 4, capacity}
+	expectedUpper := []uint32{4, 8, 32, capacity, capacity}
+
+	sb := rl.LoadShaderBuffer(capacity*uint32(unsafe.Sizeof(TestData{})), nil, rl.DynamicCopy)
+	defer rl.UnloadShaderBuffer(sb)
+	qb := rl.LoadShaderBuffer(uint32(len(queries)*4), nil, rl.DynamicCopy)
+	defer rl.UnloadShaderBuffer(qb)
+	ob := rl.LoadShaderBuffer(uint32(len(queries)*4), nil, rl.DynamicCopy)
+	defer rl.UnloadShaderBuffer(ob)
+
+	var p runtime.Pinner
+	p.Pin(unsafe.SliceData(records))
+	p.Pin(unsafe.SliceData(queries))
+	rl.UpdateShaderBuffer(sb, unsafe.Pointer(unsafe.SliceData(records)), capacity*uint32(unsafe.Sizeof(TestData{})), 0)
+	rl.UpdateShaderBuffer(qb, unsafe.Pointer(unsafe.SliceData(queries)), uint32(len(queries)*4), 0)
+	p.Unpin()
+
+	actual := make([]uint32, len(queries))
+	bs.LowerBound(sb, capacity, qb, len(queries), ob)
+	readBuffer(ob, actual)
+	arraysEqual(t, expectedLower, actual)
+
+	bs.UpperBound(sb, capacity, qb, len(queries), ob)
+	readBuffer(ob, actual)
+	arraysEqual(t, expectedUpper, actual)
+}
+
+func readBuffer(buf uint32, data []uint32) {
+	var p runtime.Pinner
+	p.Pin(unsafe.SliceData(data))
+	rl.ReadShaderBuffer(buf, unsafe.Pointer(unsafe.SliceData(data)), uint32(len(data))*4, 0)
+	p.Unpin()
+}
+
+func writeBuffer(buf uint32, data []uint32) {
+	var p runtime.Pinner
+	p.Pin(unsafe.SliceData(data))
+	rl.UpdateShaderBuffer(buf, unsafe.Pointer(unsafe.SliceData(data)), uint32(len(data))*4, 0)
+	p.Unpin()
+}
@@ -0,0 +1,216 @@
+package gsort
+
+import (
+	"fmt"
+	"math/bits"
+	"runtime"
+	"unsafe"
+
+	"github.com/MatiasLyyra/fluid/gsort/internal/gl"
+)
+
+// maxWorkGroupCount is the minimum of GL_MAX_COMPUTE_WORK_GROUP_COUNT required by OpenGL.
+const maxWorkGroupCount = 65535
+
+// Segment is an independent array of records within a buffer.
+type Segment struct {
+	// Index of the first record of the array.
+	Offset uint32
+	// Count of records in the array.
+	Length uint32
+}
+
+// SortSegments sorts each segment of input_buf independently. Segments must not overlap.
+//
+// Segments of at most LocalSortSize records are sorted together with a single set of dispatches, one work group per
+// segment, entirely in shared memory. Longer segments are sorted together with a single radix sort of their
+// concatenation, with the index of the segment as the most significant key. The total length of the longer segments
+// must not exceed the capacity.
+func (pfs *RadixSort) SortSegments(input_buf uint32, segments []Segment) {
+	defer saveState().restore()
+	local := make([]Segment, 0, len(segments))
+	var long []longSegment
+	total := uint32(0)
+	for _, segment := range segments {
+		switch {
+		case segment.Length <= 1:
+		case segment.Length <= pfs.localSortSize:
+			local = append(local, segment)
+		default:
+			long = append(long, longSegment{Offset: segment.Offset, Start: total})
+			total += segment.Length
+		}
+	}
+	if len(local) > 0 {
+		pfs.uploadSegments(local)
+		for i := len(pfs.keys) - 1; i >= 0; i-- {
+			pfs.localSort(&pfs.keys[i], input_buf, len(local))
+		}
+	}
+	if len(long) > 0 {
+		if total > pfs.capacity {
+			panic(fmt.Sprintf("total length %d of the segments longer than LocalSortSize exceeds the capacity %d", total, pfs.capacity))
+		}
+		if pfs.long == nil {
+			pfs.long = newLongSegmentSort(pfs.settings)
+		}
+		pfs.long.sort(input_buf, long, total)
+	}
+}
+
+// localSort sorts the first count segments of the segment table by a single key.
+func (pfs *RadixSort) localSort(key *radixKey, buf uint32, count int) {
+	gl.UseProgram(key.shaderLocalSort)
+	gl.Uniform1ui(key.shaderLocalSortUniformKeyBits, key.bits)
+	bindBuffer(buf, 1)
+	bindBuffer(pfs.segmentTableBuffer, 2)
+	for first := 0; first < count; first += maxWorkGroupCount {
+		gl.Uniform1ui(key.shaderLocalSortUniformSegments, uint32(first))
+		gl.DispatchCompute(uint32(min(count-first, maxWorkGroupCount)), 1, 1)
+	}
+	gl.UseProgram(0)
+	gl.MemoryBarrier(gl.SHADER_STORAGE_BARRIER_BIT)
+}
+
+func (pfs *RadixSort) uploadSegments(segments []Segment) {
+	uploadTable(&pfs.segmentTableBuffer, &pfs.segmentTableCapacity, segments)
+}
+
+// uploadTable writes table to the beginning of buffer, replacing buffer with a larger one when it has less than
+// len(table) values.
+func uploadTable[T any](buffer *uint32, capacity *int, table []T) {
+	var p runtime.Pinner
+	p.Pin(unsafe.SliceData(table))
+	defer p.Unpin()
+	var zero T
+	size := uint32(len(table)) * uint32(unsafe.Sizeof(zero))
+	if len(table) > *capacity {
+		if *buffer != 0 {
+			unloadBuffer(*buffer)
+		}
+		*buffer = loadBuffer(size, unsafe.Pointer(unsafe.SliceData(table)))
+		*capacity = len(table)
+		return
+	}
+	updateBuffer(*buffer, unsafe.Pointer(unsafe.SliceData(table)), size, 0)
+}
+
+// longSegment is a segment too long for the local sort.
+type longSegment struct {
+	// Index of the first record of the segment in the input.
+	Offset uint32
+	// Index of the first record of the segment in the concatenation of the long segments.
+	Start uint32
+}
+
+// longSegmentSort sorts segments too long for the local sort together. A sort entry holding the index of the segment,
+// the key fields and the index of the record is gathered for each record. Entries are sorted by the segment and the
+// keys, and the records are then moved in the order of the entries back to their segments.
+type longSegmentSort struct {
+	settings                      SortSettings
+	shaderGather                  uint32
+	shaderGatherUniformInput      int32
+	shaderGatherUniformSegments   int32
+	shaderScatter                 uint32
+	shaderScatterUniformInput     int32
+	shaderScatterUniformWriteBack int32
+	segmentTableBuffer            uint32
+	segmentTableCapacity          int
+	entriesBuffer                 uint32
+	scratchBuffer                 uint32
+	workGroupSize                 uint32
+	// Radix sorts of the entries by the bits needed for the count of segments.
+	entrySorts map[uint32]*RadixSort
+}
+
+// getSegmentShaderSettings returns shader settings for gathering and scattering the sort entries of long segments.
+func (settings SortSettings) getSegmentShaderSettings() shaderSettings {
+	keys := settings.getKeys()
+	internalSettings := settings.getShaderSettings()
+	internalSettings.EntryWords = uint32(len(keys)) + 2
+	for _, key := range keys {
+		internalSettings.KeyWords = append(internalSettings.KeyWords, key.Offset/4)
+	}
+	return internalSettings
+}
+
+func newLongSegmentSort(settings SortSettings) *longSegmentSort {
+	internalSettings := settings.getSegmentShaderSettings()
+	capacity := settings.getCapacity()
+	gatherProg := loadShader("shaders/segment_gather.glsl", internalSettings)
+	scatterProg := loadShader("shaders/segment_scatter.glsl", internalSettings)
+	return &longSegmentSort{
+		settings:                      settings,
+		shaderGather:                  gatherProg,
+		shaderGatherUniformInput:      uniformLocation(gatherProg, "n_input"),
+		shaderGatherUniformSegments:   uniformLocation(gatherProg, "n_segments"),
+		shaderScatter:                 scatterProg,
+		shaderScatterUniformInput:     uniformLocation(scatterProg, "n_input"),
+		shaderScatterUniformWriteBack: uniformLocation(scatterProg, "write_back"),
+		entriesBuffer:                 loadBuffer(capacity*internalSettings.EntryWords*4, nil),
+		scratchBuffer:                 loadBuffer(capacity*settings.getInputDataSize(), nil),
+		workGroupSize:                 internalSettings.WorkGroupSize,
+		entrySorts:                    make(map[uint32]*RadixSort),
+	}
+}
+
+// entrySort returns the radix sort of entries for count segments.
+func (ls *longSegmentSort) entrySort(count int) *RadixSort {
+	segmentBits := multipleOf(max(uint32(bits.Len32(uint32(count-1))), 1), 2)
+	if gs, ok := ls.entrySorts[segmentBits]; ok {
+		return gs
+	}
+	keys := ls.settings.getKeys()
+	entryKeys := []SortKey{{Offset: 0, Bits: segmentBits}}
+	for i, key := range keys {
+		entryKeys = append(entryKeys, SortKey{Offset: 4 * uint32(i+1), Bits: key.Bits})
+	}
+	gs := New(ls.settings.
+		WithInputDataSize(4 * (uint32(len(keys)) + 2)).
+		WithKeys(entryKeys...))
+	ls.entrySorts[segmentBits] = gs
+	return gs
+}
+
+func (ls *longSegmentSort) sort(buf uint32, segments []longSegment, total uint32) {
+	uploadTable(&ls.segmentTableBuffer, &ls.segmentTableCapacity, segments)
+	workGroups := multipleOf(total, ls.workGroupSize) / ls.workGroupSize
+
+	gl.UseProgram(ls.shaderGather)
+	gl.Uniform1ui(ls.shaderGatherUniformInput, total)
+	gl.Uniform1ui(ls.shaderGatherUniformSegments, uint32(len(segments)))
+	bindBuffer(buf, 1)
+	bindBuffer(ls.segmentTableBuffer, 2)
+	bindBuffer(ls.entriesBuffer, 3)
+	gl.DispatchCompute(workGroups, 1, 1)
+	gl.UseProgram(0)
+	gl.MemoryBarrier(gl.SHADER_STORAGE_BARRIER_BIT)
+
+	ls.entrySort(len(segments)).Sort(ls.entriesBuffer, int(total))
+
+	gl.UseProgram(ls.shaderScatter)
+	gl.Uniform1ui(ls.shaderScatterUniformInput, total)
+	bindBuffer(buf, 1)
+	bindBuffer(ls.segmentTableBuffer, 2)
+	bindBuffer(ls.entriesBuffer, 3)
+	bindBuffer(ls.scratchBuffer, 4)
+	for _, writeBack := range []uint32{0, 1} {
+		gl.Uniform1ui(ls.shaderScatterUniformWriteBack, writeBack)
+		gl.DispatchCompute(workGroups, 1, 1)
+		gl.MemoryBarrier(gl.SHADER_STORAGE_BARRIER_BIT)
+	}
+	gl.UseProgram(0)
+}
+
+func (ls *longSegmentSort) free() {
+	gl.DeleteProgram(ls.shaderGather)
+	gl.DeleteProgram(ls.shaderScatter)
+	if ls.segmentTableBuffer != 0 {
+		unloadBuffer(ls.segmentTableBuffer)
+	}
+	unloadBuffer(ls.entriesBuffer)
+	unloadBuffer(ls.scratchBuffer)
+	for _, gs := range ls.entrySorts {
+		gs.Free()
+	}
+}
@@ -0,0 +1,75 @@
+//go:build opengl43
+
+package gsort_test
+
+import (
+	"cmp"
+	"math/rand"
+	"runtime"
+	"slices"
+	"testing"
+	"unsafe"
+
+	"github.com/MatiasLyyra/fluid/gsort"
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+func TestSortSegments(t *testing.T) {
+	type TestData struct {
+		key   uint32
+		data1 uint32
+	}
+	const capacity = 1 << 16
+	initialize(t)
+
+	r := rand.New(rand.NewSource(0))
+	settings, err := gsort.SettingsFor[TestData]("key", capacity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gs := gsort.New(settings)
+	defer gs.Free()
+
+	sb := rl.LoadShaderBuffer(capacity*uint32(unsafe.Sizeof(TestData{})), nil, rl.DynamicCopy)
+	defer rl.UnloadShaderBuffer(sb)
+
+	// Segments of varying lengths with gaps between them, including ones longer than the local sort size.
+	var segments []gsort.Segment
+	offset := uint32(0)
+	for _, length := range []uint32{0, 1, 2, 3, 100, 255, 256, 257, 1000, 1024, 1025, 4000, 10000, 1 << 14} {
+		segments = append(segments, gsort.Segment{Offset: offset, Length: length})
+		offset += length + uint32(r.Intn(16))
+	}
+	r.Shuffle(len(segments), func(i, j int) { segments[i], segments[j] = segments[j], segments[i] })
+
+	testDataExpected := make([]TestData, capacity)
+	testDataActual := make([]TestData, capacity)
+	for i := range testDataExpected {
+		testDataExpected[i] = TestData{
+			key:   r.Uint32() % 4096,
+			data1: uint32(i),
+		}
+		testDataActual[i] = testDataExpected[i]
+	}
+	for _, segment := range segments {
+		slices.SortStableFunc(testDataExpected[segment.Offset:segment.Offset+segment.Length], func(a, b TestData) int {
+			return cmp.Compare(a.key, b.key)
+		})
+	}
+	var p runtime.Pinner
+	p.Pin(unsafe.SliceData(testDataActual))
+	rl.UpdateShaderBuffer(sb, unsafe.Pointer(unsafe.SliceData(testDataActual)), capacity*uint32(unsafe.Sizeof(TestData{})), 0)
+	p.Unpin()
+
+	gs.SortSegments(sb, segments)
+
+	p.Pin(unsafe.SliceData(testDataActual))
+	rl.ReadShaderBuffer(sb, unsafe.Pointer(unsafe.SliceData(testDataActual)), capacity*uint32(unsafe.Sizeof(TestData{})), 0)
+	p.Unpin()
+
+	for i := range testDataExpected {
+		if testDataExpected[i] != testDataActual[i] {
+			t.Fatalf("actual value differs at index %d, actual %d != %d expected", i, testDataActual[i], testDataExpected[i])
+		}
+	}
+}
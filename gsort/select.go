@@ -0,0 +1,95 @@
+package gsort
+
+import (
+	"math"
+	"math/bits"
+
+	"github.com/MatiasLyyra/fluid/gsort/internal/gl"
+)
+
+// SelectK moves the k records with the smallest keys to the beginning of input_buf and returns the k-th smallest key.
+//
+// Selection is done with radix select: the histogram of each 2-bit digit is calculated with the same scan shaders used by Sort,
+// starting from the most significant digit and narrowing down to the keys sharing the digits selected so far. Records with
+// the k-th key are selected in their original order, so the last selected one is found the same way from the digits of
+// the record indices. The records are then partitioned stably to the selected and the remaining records, so the first k
+// records preserve their original relative order. Remaining records follow in the same stable order.
+//
+// To select the k largest keys, store the keys inverted (^key). When sorting by multiple keys, only the most significant
+// key is used for selection, and all of its 32 bits are compared regardless of SortKey.Bits.
+func (pfs *RadixSort) SelectK(input_buf uint32, length int, k int) uint32 {
+	if length <= 0 || k <= 0 {
+		return 0
+	}
+	defer saveState().restore()
+	k = min(k, length)
+	dataLen := uint32(length)
+	dataLenMultiple := multipleOf(dataLen, pfs.valuesPerWorkGroup)
+	workGroups := dataLenMultiple / pfs.valuesPerWorkGroup
+	key := &pfs.keys[0]
+
+	kth, rank, matching := pfs.selectDigits(key, input_buf, dataLen, workGroups, 30, radixPass{}, uint32(k-1), dataLen)
+	// Index of the last selected record with the k-th key, unless all of them are selected.
+	pivotIndex := uint32(math.MaxUint32)
+	if rank+1 < matching {
+		indexBits := int32(bits.Len32(dataLen - 1))
+		pass := radixPass{pivot: kth, selectIndex: true}
+		pivotIndex, _, _ = pfs.selectDigits(key, input_buf, dataLen, workGroups, (indexBits+1)/2*2-2, pass, rank, matching)
+	}
+
+	// Partition the records against the last selected record. Radix scan and scatter shaders handle this as a single
+	// pass with two digits, which keeps the partition stable.
+	pass := radixPass{
+		pivot:      kth,
+		pivotIndex: pivotIndex,
+		partition:  true,
+	}
+	gl.MemoryBarrier(gl.BUFFER_UPDATE_BARRIER_BIT)
+	copyBuffer(pfs.inputBuffer, input_buf, 0, 0, dataLen*pfs.inputDataSize)
+	pfs.radixScan(key, pfs.inputBuffer, dataLen, workGroups, pass)
+	pfs.blockSums.scan(workGroups * 4)
+	pfs.scatter(key, pfs.inputBuffer, input_buf, dataLen, workGroups, pass)
+	return kth
+}
+
+// selectDigits narrows down the value of the record with the given rank among the matching records, one digit at a time
+// from the digit at offset down to the least significant digit. Digits are taken from the keys, or from the indices
+// of the records with key equal to pass.pivot if pass.selectIndex is set. Returns the selected value, and the rank of
+// the record and the count of records among the matching records with that value.
+func (pfs *RadixSort) selectDigits(key *radixKey, buf uint32, dataLen uint32, workGroups uint32, offset int32, pass radixPass, rank uint32, matching uint32) (uint32, uint32, uint32) {
+	var prefix, mask uint32
+	for ; offset >= 0; offset -= 2 {
+		pass.offset = uint32(offset)
+		pass.keyMask = mask
+		pass.keyPrefix = prefix
+		pfs.radixScan(key, buf, dataLen, workGroups, pass)
+		pfs.blockSums.scan(workGroups * 4)
+		counts := pfs.digitCounts(workGroups, matching)
+
+		var digit uint32
+		for digit < 3 && rank >= counts[digit] {
+			rank -= counts[digit]
+			digit++
+		}
+		matching = counts[digit]
+		prefix |= digit << offset
+		mask |= 0x3 << offset
+	}
+	return prefix, rank, matching
+}
+
+// digitCounts reads back the total count of each digit from prefix summed block sums.
+// Matching is the total count of keys that were counted during the scan.
+func (pfs *RadixSort) digitCounts(workGroups uint32, matching uint32) [4]uint32 {
+	// Block sums are exclusive prefix sums, so the first block of digit b holds the count of all smaller digits.
+	var starts [4]uint32
+	gl.MemoryBarrier(gl.BUFFER_UPDATE_BARRIER_BIT)
+	readBufferWords(pfs.blockSums.buffer, []uint32{workGroups * 4, 2 * workGroups * 4, 3 * workGroups * 4}, starts[1:])
+
+	var counts [4]uint32
+	for b := 0; b < 3; b++ {
+		counts[b] = starts[b+1] - starts[b]
+	}
+	counts[3] = matching - starts[3]
+	return counts
+}
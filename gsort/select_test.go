@@ -0,0 +1,117 @@
+//go:build opengl43
+
+package gsort_test
+
+import (
+	"cmp"
+	"math/rand"
+	"runtime"
+	"slices"
+	"testing"
+	"unsafe"
+
+	"github.com/MatiasLyyra/fluid/gsort"
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+func TestSelectK(t *testing.T) {
+	const capacity = 1 << 16
+	initialize(t)
+
+	r := rand.New(rand.NewSource(0))
+	gs := gsort.New(gsort.NewSettings(capacity))
+	defer gs.Free()
+
+	sb := rl.LoadShaderBuffer(capacity*4, nil, rl.DynamicCopy)
+	defer rl.UnloadShaderBuffer(sb)
+
+	for td := range generateTestData(initializeRandomValuesWithMinAndMax, r, values(1, 255, 256, 1000, capacity)) {
+		for _, k := range []int{1, max(len(td.actual)/3, 1), len(td.actual)} {
+			data := slices.Clone(td.actual)
+			kth := gpuSelectK(gs, data, k, sb)
+			if kth != td.expected[k-1] {
+				t.Fatalf("k-th key for k=%d differs, actual %d != %d expected", k, kth, td.expected[k-1])
+			}
+			selected := slices.Clone(data[:k])
+			slices.Sort(selected)
+			arraysEqual(t, td.expected[:k], selected)
+		}
+	}
+}
+
+func TestSelectKStability(t *testing.T) {
+	type TestData struct {
+		data1 uint32
+		key   uint32
+	}
+	const capacity = 1 << 16
+	const k = capacity / 4
+	initialize(t)
+
+	r := rand.New(rand.NewSource(0))
+	gs := gsort.New(gsort.NewSettings(capacity).WithKeyOffset(4).WithInputDataSize(8))
+	defer gs.Free()
+
+	sb := rl.LoadShaderBuffer(capacity*uint32(unsafe.Sizeof(TestData{})), nil, rl.DynamicCopy)
+	defer rl.UnloadShaderBuffer(sb)
+
+	testData := make([]TestData, capacity)
+	for i := range testData {
+		testData[i] = TestData{
+			data1: uint32(i),
+			key:   r.Uint32() % 1024,
+		}
+	}
+	sorted := slices.Clone(testData)
+	slices.SortStableFunc(sorted, func(a, b TestData) int {
+		return cmp.Compare(a.key, b.key)
+	})
+	kth := sorted[k-1].key
+	var testDataExpected []TestData
+	for _, td := range testData {
+		if td.key < kth {
+			testDataExpected = append(testDataExpected, td)
+		}
+	}
+	for _, td := range testData {
+		if td.key == kth && len(testDataExpected) < k {
+			testDataExpected = append(testDataExpected, td)
+		}
+	}
+	slices.SortStableFunc(testDataExpected, func(a, b TestData) int {
+		return cmp.Compare(a.data1, b.data1)
+	})
+
+	var p runtime.Pinner
+	p.Pin(unsafe.SliceData(testData))
+	rl.UpdateShaderBuffer(sb, unsafe.Pointer(unsafe.SliceData(testData)), capacity*uint32(unsafe.Sizeof(TestData{})), 0)
+	p.Unpin()
+
+	if actual := gs.SelectK(sb, capacity, k); actual != kth {
+		t.Fatalf("k-th key differs, actual %d != %d expected", actual, kth)
+	}
+
+	p.Pin(unsafe.SliceData(testData))
+	rl.ReadShaderBuffer(sb, unsafe.Pointer(unsafe.SliceData(testData)), capacity*uint32(unsafe.Sizeof(TestData{})), 0)
+	p.Unpin()
+
+	for i := range testDataExpected {
+		if testDataExpected[i] != testData[i] {
+			t.Fatalf("actual value differs at index %d, actual %d != %d expected", i, testData[i], testDataExpected[i])
+		}
+	}
+}
+
+func gpuSelectK(gs *gsort.RadixSort, data []uint32, k int, sb uint32) uint32 {
+	var p runtime.Pinner
+	p.Pin(unsafe.SliceData(data))
+	rl.UpdateShaderBuffer(sb, unsafe.Pointer(unsafe.SliceData(data)), uint32(len(data))*4, 0)
+	p.Unpin()
+
+	kth := gs.SelectK(sb, len(data), k)
+
+	p.Pin(unsafe.SliceData(data))
+	rl.ReadShaderBuffer(sb, unsafe.Pointer(unsafe.SliceData(data)), uint32(len(data))*4, 0)
+	p.Unpin()
+	return kth
+}
@@ -0,0 +1,69 @@
+package gsort
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// SettingsFor returns SortSettings for sorting records of type T by the uint32 field keyField.
+//
+// InputDataSize and KeyOffset are derived from the Go memory layout of T. InputData struct in the shaders is laid out as
+// an array of 4-byte words in std430, so T may contain only 32-bit integer and float fields, and arrays and structs of
+// them, at the same offsets as in a std430 block.
+func SettingsFor[T any](keyField string, capacity uint32) (SortSettings, error) {
+	t := reflect.TypeFor[T]()
+	if t.Kind() != reflect.Struct {
+		return SortSettings{}, fmt.Errorf("gsort: %v is not a struct", t)
+	}
+	if err := checkStd430Layout(t); err != nil {
+		return SortSettings{}, fmt.Errorf("gsort: %v: %w", t, err)
+	}
+
+	field, ok := t.FieldByName(keyField)
+	if !ok {
+		return SortSettings{}, fmt.Errorf("gsort: %v has no field %v", t, keyField)
+	}
+	if field.Type.Kind() != reflect.Uint32 {
+		return SortSettings{}, fmt.Errorf("gsort: key field %v.%v is %v, expected uint32", t, keyField, field.Type)
+	}
+	// Offset of a promoted field is relative to the embedded struct, so offsets of the whole path are summed.
+	var offset uintptr
+	parent := t
+	for _, i := range field.Index {
+		f := parent.Field(i)
+		offset += f.Offset
+		parent = f.Type
+	}
+
+	return NewSettings(capacity).WithInputDataSize(uint32(t.Size())).WithKeyOffset(uint32(offset)), nil
+}
+
+// checkStd430Layout checks that values of type t contain only 32-bit scalars, and arrays and structs of them, at the
+// same offsets on the CPU and the GPU. 32-bit scalars are 4-byte aligned in std430, so structs of them have no padding.
+func checkStd430Layout(t reflect.Type) error {
+	switch t.Kind() {
+	case reflect.Int32, reflect.Uint32, reflect.Float32:
+		return nil
+	case reflect.Array:
+		return checkStd430Layout(t.Elem())
+	case reflect.Struct:
+		var offset uintptr
+		for i := range t.NumField() {
+			f := t.Field(i)
+			if err := checkStd430Layout(f.Type); err != nil {
+				return fmt.Errorf("field %v: %w", f.Name, err)
+			}
+			if f.Offset != offset {
+				return fmt.Errorf("field %v is at offset %d, std430 offset is %d", f.Name, f.Offset, offset)
+			}
+			offset += f.Type.Size()
+		}
+		// Go pads structs ending with a zero-sized field.
+		if t.Size() != offset {
+			return fmt.Errorf("size of %v is %d bytes, std430 size is %d", t, t.Size(), offset)
+		}
+		return nil
+	default:
+		return fmt.Errorf("%v values are not 32-bit scalars", t)
+	}
+}
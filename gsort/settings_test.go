@@ -0,0 +1,83 @@
+package gsort_test
+
+import (
+	"testing"
+
+	"github.com/MatiasLyyra/fluid/gsort"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSettingsFor(t *testing.T) {
+	type TestData struct {
+		data1 uint32
+		key   uint32
+		data2 uint32
+	}
+	settings, err := gsort.SettingsFor[TestData]("key", 1024)
+	assert.NoError(t, err)
+	assert.Equal(t, gsort.NewSettings(1024).WithKeyOffset(4).WithInputDataSize(12), settings)
+}
+
+func TestSettingsForEmbeddedKey(t *testing.T) {
+	type Header struct {
+		id   uint32
+		code uint32
+	}
+	type TestData struct {
+		position [2]float32
+		Header
+	}
+	settings, err := gsort.SettingsFor[TestData]("code", 1024)
+	assert.NoError(t, err)
+	assert.Equal(t, gsort.NewSettings(1024).WithKeyOffset(12).WithInputDataSize(16), settings)
+}
+
+func TestSettingsForRejectsInvalidLayouts(t *testing.T) {
+	type Padded struct {
+		a   uint16
+		key uint32
+		b   uint16
+		c   uint16
+	}
+	type WrongSize struct {
+		a, b, c uint16
+	}
+	type Pointer struct {
+		key uint32
+		p   *uint32
+	}
+	type FloatKey struct {
+		key float32
+	}
+	type Float64 struct {
+		key   uint32
+		value float64
+	}
+	type Bool struct {
+		key  uint32
+		flag bool
+		_    [3]uint8
+	}
+	type TrailingZeroSize struct {
+		key  uint32
+		tail [0]uint32
+	}
+	_, err := gsort.SettingsFor[Padded]("key", 1024)
+	assert.Error(t, err, "16-bit fields are not 4-byte words")
+	_, err = gsort.SettingsFor[WrongSize]("a", 1024)
+	assert.Error(t, err)
+	_, err = gsort.SettingsFor[Pointer]("key", 1024)
+	assert.Error(t, err)
+	_, err = gsort.SettingsFor[FloatKey]("key", 1024)
+	assert.Error(t, err)
+	_, err = gsort.SettingsFor[Float64]("key", 1024)
+	assert.Error(t, err)
+	_, err = gsort.SettingsFor[Bool]("key", 1024)
+	assert.Error(t, err)
+	_, err = gsort.SettingsFor[TrailingZeroSize]("key", 1024)
+	assert.Error(t, err)
+	_, err = gsort.SettingsFor[FloatKey]("missing", 1024)
+	assert.Error(t, err)
+	_, err = gsort.SettingsFor[uint32]("key", 1024)
+	assert.Error(t, err)
+}
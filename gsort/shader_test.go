@@ -0,0 +1,40 @@
+package gsort_test
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/MatiasLyyra/fluid/gsort"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	glslComment = regexp.MustCompile(`//.*`)
+	// input is a reserved word in GLSL ES.
+	glslInput = regexp.MustCompile(`\binput\b`)
+	// GLSL ES has no implicit conversion from int to uint.
+	glslSignedToUint = regexp.MustCompile(`\buint\s+\w+\s*=\s*-?\d+\s*;`)
+)
+
+func TestShadersES(t *testing.T) {
+	for _, settings := range []gsort.SortSettings{
+		gsort.NewSettings(1024),
+		gsort.NewSettings(1024).WithInputDataSize(8).WithKeyOffset(4),
+		gsort.NewSettings(1024).WithInputDataSize(12).WithKeyOffset(4),
+		gsort.NewSettings(1024).WithInputDataSize(16).WithKeys(gsort.SortKey{Offset: 8, Bits: 8}, gsort.SortKey{Offset: 0}),
+	} {
+		sources := gsort.RenderShaders(settings, true)
+		assert.NotEmpty(t, sources)
+		for name, source := range sources {
+			assert.True(t, strings.HasPrefix(source, "#version 310 es\nprecision highp float;\nprecision highp int;\n"), "%v has no GLSL ES header:\n%v", name, source)
+			code := glslComment.ReplaceAllString(source, "")
+			assert.NotRegexp(t, glslInput, code, "%v uses reserved word input", name)
+			assert.NotRegexp(t, glslSignedToUint, code, "%v initializes uint with int", name)
+		}
+
+		for name, source := range gsort.RenderShaders(settings, false) {
+			assert.True(t, strings.HasPrefix(source, "#version 430\n"), "%v has no GLSL 4.30 header:\n%v", name, source)
+		}
+	}
+}
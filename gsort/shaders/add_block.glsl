@@ -1,6 +1,7 @@
-#version 430
+{{ template "version" . }}
 
-#define WORKGROUP_ITEMS {{ .WorkGroupItems }}
+#define WORKGROUP_ITEMS {{ .WorkGroupItems }}u
+#define ITEMS_PER_THREAD {{ .ItemsPerThread }}u
 
 layout (local_size_x = {{ .WorkGroupSize }}) in;
 
@@ -8,17 +9,18 @@ uniform uint input_offset;
 uniform uint sum_offset;
 
 layout(std430, binding = 1) buffer input_data {
-    uint input[];
+    uint values[];
 };
 
 void main()
 {
     uint thread_id    = gl_LocalInvocationID.x;
-    uint global_id    = gl_GlobalInvocationID.x;
     uint workgroup_id = gl_WorkGroupID.x;
-    uint elem_id      = thread_id * 2;
-    uint gelem_id     = global_id * 2;
+    uint gelem_id     = workgroup_id * WORKGROUP_ITEMS + thread_id * ITEMS_PER_THREAD;
 
-    input[input_offset + gelem_id    ] += input[sum_offset + workgroup_id];
-    input[input_offset + gelem_id + 1] += input[sum_offset + workgroup_id];
+    uint block_sum = values[sum_offset + workgroup_id];
+    for (uint i = 0u; i < ITEMS_PER_THREAD; i++)
+    {
+        values[input_offset + gelem_id + i] += block_sum;
+    }
 }
\ No newline at end of file
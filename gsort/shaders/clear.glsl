@@ -0,0 +1,20 @@
+{{ template "version" . }}
+
+layout (local_size_x = {{ .WorkGroupSize }}) in;
+
+uniform uint n_input;
+
+layout(std430, binding = 1) buffer data_buffer {
+    uint data[];
+};
+
+// Zeroes the first n_input values, as OpenGL ES has no glClearBufferSubData. Values are strided by the size of the
+// dispatch, so any count fits the work group count limit.
+void main()
+{
+    uint stride = gl_NumWorkGroups.x * {{ .WorkGroupSize }}u;
+    for (uint i = gl_GlobalInvocationID.x; i < n_input; i += stride)
+    {
+        data[i] = 0u;
+    }
+}
@@ -1,41 +1,118 @@
+{{ define "version" -}}
+{{ if .ES -}}
+#version 310 es
+precision highp float;
+precision highp int;
+{{- else -}}
+#version 430
+{{- end }}
+{{- end }}
+
 {{ define "common_utilities" }}
+#define WORKGROUP_SIZE (WORKGROUP_ITEMS / ITEMS_PER_THREAD)
+// Shared memory indices are padded by one for every NUM_BANKS values to avoid bank conflicts, as in GPU Gems 3.
+// The same padding keeps the consecutive items of each thread in distinct banks when ITEMS_PER_THREAD is at most 32.
+#define LOG_NUM_BANKS 5u
+#define CONFLICT_FREE_OFFSET(i) ((i) >> LOG_NUM_BANKS)
+#define CNT(i) cnt[(i) + CONFLICT_FREE_OFFSET(i)]
+#define THREAD_SUM(i) thread_sums[(i) + CONFLICT_FREE_OFFSET(i)]
+
+shared uint cnt[WORKGROUP_ITEMS + CONFLICT_FREE_OFFSET(WORKGROUP_ITEMS)];
+shared uint thread_sums[WORKGROUP_SIZE + CONFLICT_FREE_OFFSET(WORKGROUP_SIZE)];
+
+// Replaces the WORKGROUP_ITEMS values of cnt with their exclusive prefix sum. Each thread handles ITEMS_PER_THREAD
+// consecutive values, which are scanned sequentially before scanning the sums of the threads.
 void scan(uint thread_id, out uint block_sum)
 {
-    uint elem_id = thread_id * 2;
+    uint first = thread_id * ITEMS_PER_THREAD;
+    uint sum = 0u;
+    for (uint i = 0u; i < ITEMS_PER_THREAD; i++)
+    {
+        uint v = CNT(first + i);
+        CNT(first + i) = sum;
+        sum += v;
+    }
+    THREAD_SUM(thread_id) = sum;
+
     uint offset = 1u;
-    for (uint d = WORKGROUP_ITEMS >> 1; d > 0; d >>= 1)
+    for (uint d = WORKGROUP_SIZE >> 1u; d > 0u; d >>= 1u)
     {
         barrier();
         if (thread_id < d)
         {
-            uint ai = offset * (elem_id + 1) - 1;
-            uint bi = offset * (elem_id + 2) - 1;
+            uint ai = offset * (2u * thread_id + 1u) - 1u;
+            uint bi = offset * (2u * thread_id + 2u) - 1u;
 
-            cnt[bi] += cnt[ai];
+            THREAD_SUM(bi) += THREAD_SUM(ai);
         }
-        offset <<= 1;
+        offset <<= 1u;
     }
 
-    if (thread_id == 0)
+    barrier();
+    if (thread_id == 0u)
     {
-        block_sum = cnt[WORKGROUP_ITEMS - 1]; 
-        cnt[WORKGROUP_ITEMS - 1] = 0;
+        block_sum = THREAD_SUM(WORKGROUP_SIZE - 1u);
+        THREAD_SUM(WORKGROUP_SIZE - 1u) = 0u;
     }
 
-    for (uint d = 1; d < WORKGROUP_ITEMS; d <<= 1)
+    for (uint d = 1u; d < WORKGROUP_SIZE; d <<= 1u)
     {
-        offset >>= 1;
+        offset >>= 1u;
         barrier();
 
         if (thread_id < d)
         {
-            uint ai = offset * (elem_id + 1) - 1;
-            uint bi = offset * (elem_id + 2) - 1;
-            uint t = cnt[ai];
-            cnt[ai] = cnt[bi];
-            cnt[bi] += t;
+            uint ai = offset * (2u * thread_id + 1u) - 1u;
+            uint bi = offset * (2u * thread_id + 2u) - 1u;
+            uint t = THREAD_SUM(ai);
+            THREAD_SUM(ai) = THREAD_SUM(bi);
+            THREAD_SUM(bi) += t;
         }
     }
+    barrier();
+
+    uint thread_offset = THREAD_SUM(thread_id);
+    for (uint i = 0u; i < ITEMS_PER_THREAD; i++)
+    {
+        CNT(first + i) += thread_offset;
+    }
+}
+{{ end }}
+
+{{ define "radix_digit" }}
+uniform uint offset;
+uniform uint key_mask;
+uniform uint key_prefix;
+uniform uint pivot;
+uniform uint pivot_index;
+uniform uint partition_mode;
+
+// Returns the bucket of the record at index for the current pass. Keys not matching key_prefix get bucket 4, which is
+// not counted.
+// In partition mode 1 records are bucketed as 0 or 1 depending on whether (key, index) is at most (pivot, pivot_index).
+// In partition mode 2 the digits of the index are bucketed instead of the key, for the records with key equal to pivot.
+uint radix_digit(uint key, uint index)
+{
+    if (partition_mode == 1u)
+    {
+        return key < pivot || (key == pivot && index <= pivot_index) ? 0u : 1u;
+    }
+    if (partition_mode == 2u)
+    {
+        if (key != pivot) return 4u;
+        key = index;
+    }
+    if ((key & key_mask) != key_prefix) return 4u;
+    return (key >> offset) & 0x3u;
+}
+{{ end }}
+
+{{ define "head_flag" }}
+// Returns true if the element starts a new run of equal keys. Position n_input is treated as the head of an empty run
+// terminating the input.
+bool is_head(uint i)
+{
+    return i == 0u || i == n_input || input_records[i].key != input_records[i - 1u].key;
 }
 {{ end }}
 
@@ -0,0 +1,28 @@
+{{ template "version" . }}
+
+layout (local_size_x = {{ .WorkGroupSize }}) in;
+
+uniform uint n_input;
+uniform uint max_key;
+
+{{ template "input_type" . }}
+
+layout(std430, binding = 1) buffer input_buffer {
+    InputData input_records[];
+};
+
+layout(std430, binding = 2) buffer output_buffer {
+    InputData output_data[];
+};
+
+layout(std430, binding = 3) buffer offsets_buffer {
+    uint offsets[];
+};
+
+void main()
+{
+    uint global_id = gl_GlobalInvocationID.x;
+    if (global_id >= n_input) return;
+    uint pos = atomicAdd(offsets[min(input_records[global_id].key, max_key - 1u)], 1u);
+    output_data[pos] = input_records[global_id];
+}
\ No newline at end of file
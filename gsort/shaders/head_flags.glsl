@@ -0,0 +1,25 @@
+{{ template "version" . }}
+
+layout (local_size_x = {{ .WorkGroupSize }}) in;
+
+uniform uint n_input;
+
+{{ template "input_type" . }}
+
+layout(std430, binding = 1) buffer input_buffer {
+    InputData input_records[];
+};
+
+layout(std430, binding = 2) buffer flags_buffer {
+    uint flags[];
+};
+
+{{ template "head_flag" }}
+
+void main()
+{
+    uint global_id = gl_GlobalInvocationID.x;
+    // Flag is also written for the position right after the input, so that after the prefix sum it holds the count of runs.
+    if (global_id > n_input) return;
+    flags[global_id] = is_head(global_id) ? 1u : 0u;
+}
\ No newline at end of file
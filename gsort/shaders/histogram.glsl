@@ -0,0 +1,29 @@
+{{ template "version" . }}
+
+layout (local_size_x = {{ .WorkGroupSize }}) in;
+
+uniform uint n_input;
+uniform uint max_key;
+// Records are counted separately for each block of block_size consecutive records, with the counts of a key for all
+// blocks laid out next to each other. Unstable sort counts all records in a single block.
+uniform uint n_blocks;
+uniform uint block_size;
+
+{{ template "input_type" . }}
+
+layout(std430, binding = 1) buffer input_buffer {
+    InputData input_records[];
+};
+
+layout(std430, binding = 2) buffer histogram_buffer {
+    uint histogram[];
+};
+
+void main()
+{
+    uint global_id = gl_GlobalInvocationID.x;
+    if (global_id >= n_input) return;
+    // Keys outside of the range are clamped to prevent writing out of bounds.
+    uint key = min(input_records[global_id].key, max_key - 1u);
+    atomicAdd(histogram[key * n_blocks + global_id / block_size], 1u);
+}
@@ -0,0 +1,114 @@
+{{ template "version" . }}
+
+#define WORKGROUP_ITEMS {{ .WorkGroupItems }}u
+#define ITEMS_PER_THREAD {{ .ItemsPerThread }}u
+#define LOCAL_SORT_ITEMS {{ .LocalSortItems }}u
+// Each scan slot handles SLOT_ITEMS consecutive elements, and each thread handles ITEMS_PER_THREAD slots.
+#define SLOT_ITEMS (LOCAL_SORT_ITEMS / WORKGROUP_ITEMS)
+#define THREAD_ITEMS (SLOT_ITEMS * ITEMS_PER_THREAD)
+
+layout (local_size_x = {{ .WorkGroupSize }}) in;
+
+uniform uint key_bits;
+uniform uint segment_offset;
+
+{{ template "input_type" . }}
+
+layout(std430, binding = 1) buffer input_buffer {
+    InputData input_records[];
+};
+
+// Offset and length of each segment in records.
+layout(std430, binding = 2) buffer segments_buffer {
+    uvec2 segments[];
+};
+
+shared uint keys[LOCAL_SORT_ITEMS];
+shared uint indices[LOCAL_SORT_ITEMS];
+shared uint digit_totals[4];
+
+{{ template "common_utilities" }}
+
+void main()
+{
+    uint thread_id = gl_LocalInvocationID.x;
+    uint elem_id   = thread_id * ITEMS_PER_THREAD;
+    uint first     = thread_id * THREAD_ITEMS;
+    uvec2 segment  = segments[segment_offset + gl_WorkGroupID.x];
+    uint base      = segment.x;
+    uint n         = segment.y;
+
+    // Elements past the end of the segment get the largest possible key. Sorting is stable,
+    // so they stay after the real elements with the same key.
+    for (uint i = 0u; i < THREAD_ITEMS; i++)
+    {
+        uint e = first + i;
+        keys[e] = e < n ? input_records[base + e].key : 0xFFFFFFFFu;
+        indices[e] = e;
+    }
+
+    for (uint offset = 0u; offset < key_bits; offset += 2u)
+    {
+        barrier();
+        uint local_keys[THREAD_ITEMS];
+        uint local_indices[THREAD_ITEMS];
+        uvec4 slot_counts[ITEMS_PER_THREAD];
+        for (uint s = 0u; s < ITEMS_PER_THREAD; s++)
+        {
+            slot_counts[s] = uvec4(0u);
+        }
+        for (uint i = 0u; i < THREAD_ITEMS; i++)
+        {
+            local_keys[i] = keys[first + i];
+            local_indices[i] = indices[first + i];
+            slot_counts[i / SLOT_ITEMS][(local_keys[i] >> offset) & 0x3u]++;
+        }
+
+        // Scan the digit counts of each slot to get the position of the slot within each digit.
+        uvec4 slot_offsets[ITEMS_PER_THREAD];
+        for (uint b = 0u; b < 4u; b++)
+        {
+            for (uint s = 0u; s < ITEMS_PER_THREAD; s++)
+            {
+                CNT(elem_id + s) = slot_counts[s][b];
+            }
+            uint block_sum;
+            scan(thread_id, block_sum);
+            if (thread_id == 0u) digit_totals[b] = block_sum;
+            barrier();
+            for (uint s = 0u; s < ITEMS_PER_THREAD; s++)
+            {
+                slot_offsets[s][b] = CNT(elem_id + s);
+            }
+        }
+        uvec4 digit_base = uvec4(0u, digit_totals[0], digit_totals[0] + digit_totals[1], digit_totals[0] + digit_totals[1] + digit_totals[2]);
+
+        for (uint i = 0u; i < THREAD_ITEMS; i++)
+        {
+            uint slot = i / SLOT_ITEMS;
+            uint digit = (local_keys[i] >> offset) & 0x3u;
+            uint pos = digit_base[digit] + slot_offsets[slot][digit];
+            slot_offsets[slot][digit]++;
+            keys[pos] = local_keys[i];
+            indices[pos] = local_indices[i];
+        }
+    }
+    barrier();
+
+    // Read the records of this thread before any of them are overwritten, and store the sorted position
+    // of each original element to keys.
+    InputData records[THREAD_ITEMS];
+    for (uint i = 0u; i < THREAD_ITEMS; i++)
+    {
+        uint e = first + i;
+        if (e < n) records[i] = input_records[base + e];
+        keys[indices[e]] = e;
+    }
+    barrier();
+
+    for (uint i = 0u; i < THREAD_ITEMS; i++)
+    {
+        uint e = first + i;
+        if (e < n) input_records[base + keys[e]] = records[i];
+    }
+}
\ No newline at end of file
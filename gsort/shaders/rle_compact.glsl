@@ -0,0 +1,35 @@
+{{ template "version" . }}
+
+layout (local_size_x = {{ .WorkGroupSize }}) in;
+
+uniform uint n_input;
+
+{{ template "input_type" . }}
+
+layout(std430, binding = 1) buffer input_buffer {
+    InputData input_records[];
+};
+
+layout(std430, binding = 2) buffer run_index_buffer {
+    uint run_index[];
+};
+
+layout(std430, binding = 3) buffer unique_keys_buffer {
+    uint unique_keys[];
+};
+
+layout(std430, binding = 4) buffer run_starts_buffer {
+    uint run_starts[];
+};
+
+{{ template "head_flag" }}
+
+void main()
+{
+    uint global_id = gl_GlobalInvocationID.x;
+    if (global_id > n_input || !is_head(global_id)) return;
+
+    uint run = run_index[global_id];
+    run_starts[run] = global_id;
+    if (global_id < n_input) unique_keys[run] = input_records[global_id].key;
+}
\ No newline at end of file
@@ -0,0 +1,20 @@
+{{ template "version" . }}
+
+layout (local_size_x = {{ .WorkGroupSize }}) in;
+
+uniform uint n_runs;
+
+layout(std430, binding = 1) buffer run_starts_buffer {
+    uint run_starts[];
+};
+
+layout(std430, binding = 2) buffer counts_buffer {
+    uint counts[];
+};
+
+void main()
+{
+    uint global_id = gl_GlobalInvocationID.x;
+    if (global_id >= n_runs) return;
+    counts[global_id] = run_starts[global_id + 1u] - run_starts[global_id];
+}
\ No newline at end of file
@@ -1,17 +1,19 @@
-#version 430
+{{ template "version" . }}
 
-#define WORKGROUP_ITEMS {{ .WorkGroupItems }}
+#define WORKGROUP_ITEMS {{ .WorkGroupItems }}u
+#define ITEMS_PER_THREAD {{ .ItemsPerThread }}u
 
 layout (local_size_x = {{ .WorkGroupSize }}) in;
 
 uniform uint n_input;
 uniform uint n_workgroups;
-uniform uint offset;
+
+{{ template "radix_digit" }}
 
 {{ template "input_type" . }}
 
 layout(std430, binding = 1) buffer input_buffer {
-    InputData input[];
+    InputData input_records[];
 };
 
 layout(std430, binding = 2) buffer output_buffer {
@@ -26,39 +28,54 @@ layout(std430, binding = 4) buffer block_sums_buffer {
     uint block_sums[];
 };
 
+// Records of the block sorted by their digit.
+shared InputData shuffled[WORKGROUP_ITEMS];
+shared uint digit_counts[4];
+shared uint digit_starts[4];
+
 void main()
 {
     uint thread_id    = gl_LocalInvocationID.x;
-    uint global_id    = gl_GlobalInvocationID.x;
     uint workgroup_id = gl_WorkGroupID.x;
-    uint elem_id      = thread_id * 2;
-    uint gelem_id     = global_id * 2;
+    uint gelem_id     = workgroup_id * WORKGROUP_ITEMS + thread_id * ITEMS_PER_THREAD;
 
-    uint v1 = 0u;
-    uint v2 = 0u;
+    for (uint b = thread_id; b < 4u; b += gl_WorkGroupSize.x) {
+        digit_counts[b] = 0u;
+    }
+    barrier();
 
-    if (gelem_id < n_input) {
-        v1 = input[gelem_id].key;
+    uint digits[ITEMS_PER_THREAD];
+    for (uint i = 0u; i < ITEMS_PER_THREAD; i++) {
+        digits[i] = gelem_id + i < n_input ? radix_digit(input_records[gelem_id + i].key, gelem_id + i) : 4u;
+        if (digits[i] < 4u) atomicAdd(digit_counts[digits[i]], 1u);
     }
-    if (gelem_id + 1 < n_input) {
-        v2 = input[gelem_id + 1].key;
+    barrier();
+
+    if (thread_id == 0u) {
+        uint sum = 0u;
+        for (uint b = 0u; b < 4u; b++) {
+            digit_starts[b] = sum;
+            sum += digit_counts[b];
+        }
     }
+    barrier();
 
-    uint b1 = (v1 >> offset) & 0x3u;
-    uint b2 = (v2 >> offset) & 0x3u;
-
-    uint pos1 = local_prefix_sum[gelem_id    ];
-    uint pos2 = local_prefix_sum[gelem_id + 1];
-
-    uint idx1 = b1 * n_workgroups + workgroup_id;
-    uint idx2 = b2 * n_workgroups + workgroup_id;
-
-    uint block1 = block_sums[idx1];
-    uint block2 = block_sums[idx2];
-
-    pos1 += block1;
-    pos2 += block2;
-
-    if (gelem_id     < n_input && pos1 < n_input) output_data[pos1] = input[gelem_id    ];
-    if (gelem_id + 1 < n_input && pos2 < n_input) output_data[pos2] = input[gelem_id + 1];
+    // Shuffle the block locally by the digit. Local prefix sum is the rank of the record among the records with the same
+    // digit in the block, so the order of equal digits is preserved.
+    for (uint i = 0u; i < ITEMS_PER_THREAD; i++) {
+        if (digits[i] < 4u) shuffled[digit_starts[digits[i]] + local_prefix_sum[gelem_id + i]] = input_records[gelem_id + i];
+    }
+    barrier();
+
+    // Records with the same digit are consecutive in both the shuffled block and the output, so consecutive invocations
+    // write to consecutive addresses. Digit of a shuffled record is found from the digit starts, as the digit may depend
+    // on the index of the record before the shuffle.
+    uint total = digit_starts[3] + digit_counts[3];
+    for (uint i = thread_id; i < total; i += gl_WorkGroupSize.x) {
+        InputData data = shuffled[i];
+        uint b = 0u;
+        while (b < 3u && i >= digit_starts[b + 1u]) b++;
+        uint pos = block_sums[b * n_workgroups + workgroup_id] + i - digit_starts[b];
+        if (pos < n_input) output_data[pos] = data;
+    }
 }
\ No newline at end of file
@@ -0,0 +1,44 @@
+{{ template "version" . }}
+
+layout (local_size_x = {{ .WorkGroupSize }}) in;
+
+uniform uint n_input;
+uniform uint n_queries;
+uniform uint upper_bound;
+
+{{ template "input_type" . }}
+
+layout(std430, binding = 1) buffer input_buffer {
+    InputData input_records[];
+};
+
+layout(std430, binding = 2) buffer query_buffer {
+    uint queries[];
+};
+
+layout(std430, binding = 3) buffer output_buffer {
+    uint indices[];
+};
+
+void main()
+{
+    uint global_id = gl_GlobalInvocationID.x;
+    if (global_id >= n_queries) return;
+
+    uint query = queries[global_id];
+    uint lo = 0u;
+    uint hi = n_input;
+    while (lo < hi)
+    {
+        uint mid = lo + (hi - lo) / 2u;
+        uint key = input_records[mid].key;
+        // Lower bound finds the first key >= query, upper bound the first key > query.
+        bool right = upper_bound != 0u ? key <= query : key < query;
+        if (right) {
+            lo = mid + 1u;
+        } else {
+            hi = mid;
+        }
+    }
+    indices[global_id] = lo;
+}
\ No newline at end of file
@@ -0,0 +1,48 @@
+{{ template "version" . }}
+
+#define RECORD_WORDS {{ .RecordWords }}u
+#define ENTRY_WORDS {{ .EntryWords }}u
+
+layout (local_size_x = {{ .WorkGroupSize }}) in;
+
+uniform uint n_input;
+uniform uint n_segments;
+
+// Records are read as words, so that every key field can be read without knowing the layout of the rest of the record.
+layout(std430, binding = 1) buffer input_buffer {
+    uint input_words[];
+};
+
+// Offset of each segment in the input and its start in the concatenated segments.
+layout(std430, binding = 2) buffer segments_buffer {
+    uvec2 segments[];
+};
+
+// Sort entry of each record: index of the segment, key fields and index of the record in the input.
+layout(std430, binding = 3) buffer entries_buffer {
+    uint entries[];
+};
+
+void main()
+{
+    uint id = gl_GlobalInvocationID.x;
+    if (id >= n_input) return;
+
+    // Find the last segment starting at or before id.
+    uint lo = 0u;
+    uint hi = n_segments - 1u;
+    while (lo < hi)
+    {
+        uint mid = (lo + hi + 1u) >> 1u;
+        if (segments[mid].y <= id) lo = mid;
+        else hi = mid - 1u;
+    }
+    uint index = segments[lo].x + id - segments[lo].y;
+
+    uint base = id * ENTRY_WORDS;
+    entries[base] = lo;
+{{- range $i, $word := .KeyWords }}
+    entries[base + 1u + {{ $i }}u] = input_words[index * RECORD_WORDS + {{ $word }}u];
+{{- end }}
+    entries[base + ENTRY_WORDS - 1u] = index;
+}
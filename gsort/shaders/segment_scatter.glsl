@@ -0,0 +1,53 @@
+{{ template "version" . }}
+
+#define RECORD_WORDS {{ .RecordWords }}u
+#define ENTRY_WORDS {{ .EntryWords }}u
+
+layout (local_size_x = {{ .WorkGroupSize }}) in;
+
+uniform uint n_input;
+// Records are first copied in the sorted order to the scratch buffer, and then written back to their segments.
+uniform uint write_back;
+
+layout(std430, binding = 1) buffer input_buffer {
+    uint input_words[];
+};
+
+layout(std430, binding = 2) buffer segments_buffer {
+    uvec2 segments[];
+};
+
+// Sort entries sorted by segment and key.
+layout(std430, binding = 3) buffer entries_buffer {
+    uint entries[];
+};
+
+layout(std430, binding = 4) buffer scratch_buffer {
+    uint scratch_words[];
+};
+
+void main()
+{
+    uint id = gl_GlobalInvocationID.x;
+    if (id >= n_input) return;
+
+    uint base = id * ENTRY_WORDS;
+    if (write_back == 0u)
+    {
+        uint src = entries[base + ENTRY_WORDS - 1u];
+        for (uint w = 0u; w < RECORD_WORDS; w++)
+        {
+            scratch_words[id * RECORD_WORDS + w] = input_words[src * RECORD_WORDS + w];
+        }
+    }
+    else
+    {
+        // Entries are ordered by segment first, so the entry at id belongs to the same segment as position id.
+        uvec2 segment = segments[entries[base]];
+        uint dst = segment.x + id - segment.y;
+        for (uint w = 0u; w < RECORD_WORDS; w++)
+        {
+            input_words[dst * RECORD_WORDS + w] = scratch_words[id * RECORD_WORDS + w];
+        }
+    }
+}
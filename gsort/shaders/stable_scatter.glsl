@@ -0,0 +1,71 @@
+{{ template "version" . }}
+
+layout (local_size_x = {{ .WorkGroupSize }}) in;
+
+uniform uint n_input;
+uniform uint max_key;
+uniform uint n_blocks;
+uniform uint block_size;
+
+{{ template "input_type" . }}
+
+layout(std430, binding = 1) buffer input_buffer {
+    InputData input_records[];
+};
+
+layout(std430, binding = 2) buffer output_buffer {
+    InputData output_data[];
+};
+
+// Scanned histogram of each key and block, advanced by the work group of the block as its records are scattered.
+layout(std430, binding = 3) buffer offsets_buffer {
+    uint offsets[];
+};
+
+shared uint tile_keys[{{ .WorkGroupSize }}];
+
+// Each work group scatters a single block in tiles of one record per invocation. Records are ranked within the tile by
+// the count of earlier records with the same key, which keeps records with equal keys in their original order.
+void main()
+{
+    uint block = gl_WorkGroupID.x;
+    uint local_id = gl_LocalInvocationID.x;
+    uint block_start = block * block_size;
+    uint block_end = min(block_start + block_size, n_input);
+
+    for (uint tile = block_start; tile < block_end; tile += {{ .WorkGroupSize }}u)
+    {
+        uint id = tile + local_id;
+        bool valid = id < block_end;
+        // Invalid invocations use a key that no record has after clamping.
+        uint key = valid ? min(input_records[id].key, max_key - 1u) : max_key;
+        tile_keys[local_id] = key;
+        barrier();
+
+        uint rank = 0u;
+        bool last = true;
+        for (uint i = 0u; i < {{ .WorkGroupSize }}u; i++)
+        {
+            if (tile_keys[i] == key)
+            {
+                if (i < local_id) rank++;
+                else if (i > local_id) last = false;
+            }
+        }
+        uint slot = key * n_blocks + block;
+        if (valid)
+        {
+            output_data[offsets[slot] + rank] = input_records[id];
+        }
+        memoryBarrierBuffer();
+        barrier();
+
+        // The last record of each key in the tile advances the offset past the records of the tile.
+        if (valid && last)
+        {
+            offsets[slot] += rank + 1u;
+        }
+        memoryBarrierBuffer();
+        barrier();
+    }
+}
@@ -6,6 +6,12 @@
 // and simplifications. Sorting also relies on calculating prefix sums for arbitrarily large data. For prefix sum calculations,
 // algorithm described by NVIDIA's GPU Gems 3 [2] is used.
 //
+// Shader storage buffer bindings and the current shader program are restored after each operation, so they can be shared
+// with the rendering of the host application.
+//
+// OpenGL 4.3 and OpenGL ES 3.1 contexts are supported. The API of the context is detected at runtime from GL_VERSION, and
+// the shaders are compiled as GLSL ES on OpenGL ES. On OpenGL ES, InitGL must be called before creating any sorts.
+//
 // References:
 //
 //  1. Ha, Linh & Krüger, Jens & Silva, Claudio. (2009). Fast 4-way parallel radix sorting on GPUs. Comput. Graph. Forum. 28. 2368-2378. 10.1111/j.1467-8659.2009.01542.x.
@@ -21,9 +27,7 @@ import (
 	"text/template"
 	"unsafe"
 
-	gl "github.com/go-gl/gl/v4.3-core/gl"
-
-	rl "github.com/gen2brain/raylib-go/raylib"
+	"github.com/MatiasLyyra/fluid/gsort/internal/gl"
 )
 
 //go:embed shaders/common.glsl
@@ -41,6 +45,39 @@ var addBlockShader string
 //go:embed shaders/scatter.glsl
 var scatterShader string
 
+//go:embed shaders/search.glsl
+var searchShader string
+
+//go:embed shaders/head_flags.glsl
+var headFlagsShader string
+
+//go:embed shaders/rle_compact.glsl
+var rleCompactShader string
+
+//go:embed shaders/rle_counts.glsl
+var rleCountsShader string
+
+//go:embed shaders/local_sort.glsl
+var localSortShader string
+
+//go:embed shaders/histogram.glsl
+var histogramShader string
+
+//go:embed shaders/counting_scatter.glsl
+var countingScatterShader string
+
+//go:embed shaders/clear.glsl
+var clearShader string
+
+//go:embed shaders/stable_scatter.glsl
+var stableScatterShader string
+
+//go:embed shaders/segment_gather.glsl
+var segmentGatherShader string
+
+//go:embed shaders/segment_scatter.glsl
+var segmentScatterShader string
+
 var shaderTemplate *template.Template
 
 func init() {
@@ -49,48 +86,158 @@ func init() {
 	shaderTemplate = template.Must(shaderTemplate.New("shaders/prefix_sum.glsl").Parse(prefixSumShader))
 	shaderTemplate = template.Must(shaderTemplate.New("shaders/add_block.glsl").Parse(addBlockShader))
 	shaderTemplate = template.Must(shaderTemplate.New("shaders/scatter.glsl").Parse(scatterShader))
+	shaderTemplate = template.Must(shaderTemplate.New("shaders/search.glsl").Parse(searchShader))
+	shaderTemplate = template.Must(shaderTemplate.New("shaders/head_flags.glsl").Parse(headFlagsShader))
+	shaderTemplate = template.Must(shaderTemplate.New("shaders/rle_compact.glsl").Parse(rleCompactShader))
+	shaderTemplate = template.Must(shaderTemplate.New("shaders/rle_counts.glsl").Parse(rleCountsShader))
+	shaderTemplate = template.Must(shaderTemplate.New("shaders/local_sort.glsl").Parse(localSortShader))
+	shaderTemplate = template.Must(shaderTemplate.New("shaders/histogram.glsl").Parse(histogramShader))
+	shaderTemplate = template.Must(shaderTemplate.New("shaders/counting_scatter.glsl").Parse(countingScatterShader))
+	shaderTemplate = template.Must(shaderTemplate.New("shaders/clear.glsl").Parse(clearShader))
+	shaderTemplate = template.Must(shaderTemplate.New("shaders/stable_scatter.glsl").Parse(stableScatterShader))
+	shaderTemplate = template.Must(shaderTemplate.New("shaders/segment_gather.glsl").Parse(segmentGatherShader))
+	shaderTemplate = template.Must(shaderTemplate.New("shaders/segment_scatter.glsl").Parse(segmentScatterShader))
 }
 
 type RadixSort struct {
-	shaderRadixScan                   uint32
-	shaderRadixScanUniformInput       int32
-	shaderRadixScanUniformWorkGroups  int32
-	shaderRadixScanUniformOffset      int32
-	shaderPrefixSum                   uint32
-	shaderPrefixSumUniformInput       int32
-	shaderPrefixSumUniformInputOffset int32
-	shaderPrefixSumUniformSumOffset   int32
-	shaderAddBlock                    uint32
-	shaderAddBlockUniformInputOffset  int32
-	shaderAddBlockUniformSumOffset    int32
-	shaderScatter                     uint32
-	shaderScatterUniformInput         int32
-	shaderScatterUniformOffset        int32
-	shaderScatterUniformWorkGroups    int32
-	inputBuffer                       uint32
-	localPrefixBuffer                 uint32
-	blockSumBuffer                    uint32
-	valuesPerWorkGroup                uint32
+	// Keys in priority order, most significant key first.
+	keys               []radixKey
+	inputBuffer        uint32
+	localPrefixBuffer  uint32
+	blockSums          *prefixSum
+	valuesPerWorkGroup uint32
+	inputDataSize      uint32
+	capacity           uint32
+	localSortSize      uint32
+	settings           SortSettings
+	// Segment table used by local sort, allocated on first use.
+	segmentTableBuffer   uint32
+	segmentTableCapacity int
+	// Sorting of segments too long for the local sort, allocated on first use.
+	long *longSegmentSort
+}
+
+// radixKey holds radix scan and scatter shaders compiled for a single key field of the input data.
+type radixKey struct {
+	shaderRadixScan                  uint32
+	shaderRadixScanUniformInput      int32
+	shaderRadixScanUniformWorkGroups int32
+	shaderRadixScanUniformDigit      digitUniforms
+	shaderScatter                    uint32
+	shaderScatterUniformInput        int32
+	shaderScatterUniformWorkGroups   int32
+	shaderScatterUniformDigit        digitUniforms
+	shaderLocalSort                  uint32
+	shaderLocalSortUniformKeyBits    int32
+	shaderLocalSortUniformSegments   int32
+	bits                             uint32
+}
+
+func newRadixKey(settings shaderSettings, bits uint32) radixKey {
+	radixScanProg := loadShader("shaders/radix_scan.glsl", settings)
+	scatterProg := loadShader("shaders/scatter.glsl", settings)
+	localSortProg := loadShader("shaders/local_sort.glsl", settings)
+	return radixKey{
+		shaderRadixScan:                  radixScanProg,
+		shaderRadixScanUniformInput:      uniformLocation(radixScanProg, "n_input"),
+		shaderRadixScanUniformWorkGroups: uniformLocation(radixScanProg, "n_workgroups"),
+		shaderRadixScanUniformDigit:      getDigitUniforms(radixScanProg),
+		shaderScatter:                    scatterProg,
+		shaderScatterUniformInput:        uniformLocation(scatterProg, "n_input"),
+		shaderScatterUniformWorkGroups:   uniformLocation(scatterProg, "n_workgroups"),
+		shaderScatterUniformDigit:        getDigitUniforms(scatterProg),
+		shaderLocalSort:                  localSortProg,
+		shaderLocalSortUniformKeyBits:    uniformLocation(localSortProg, "key_bits"),
+		shaderLocalSortUniformSegments:   uniformLocation(localSortProg, "segment_offset"),
+		bits:                             bits,
+	}
+}
+
+func (key *radixKey) free() {
+	gl.DeleteProgram(key.shaderRadixScan)
+	gl.DeleteProgram(key.shaderScatter)
+	gl.DeleteProgram(key.shaderLocalSort)
+}
+
+// digitUniforms holds uniform locations of the radix_digit template shared by radix scan and scatter shaders.
+type digitUniforms struct {
+	offset     int32
+	keyMask    int32
+	keyPrefix  int32
+	pivot      int32
+	pivotIndex int32
+	partition  int32
+}
+
+// radixPass describes how keys are bucketed to digits during a single scan and scatter pass.
+type radixPass struct {
+	// Bit offset of the 2-bit digit within the key.
+	offset uint32
+	// Keys for which key & keyMask != keyPrefix are excluded from the digit counts.
+	keyMask   uint32
+	keyPrefix uint32
+	// When partition is set, records are bucketed to 0 if (key, index) is at most (pivot, pivotIndex) and to 1 otherwise.
+	pivot      uint32
+	pivotIndex uint32
+	partition  bool
+	// When selectIndex is set, digits are taken from the index of the records with key equal to pivot instead.
+	selectIndex bool
+}
+
+func getDigitUniforms(shaderProg uint32) digitUniforms {
+	return digitUniforms{
+		offset:     uniformLocation(shaderProg, "offset"),
+		keyMask:    uniformLocation(shaderProg, "key_mask"),
+		keyPrefix:  uniformLocation(shaderProg, "key_prefix"),
+		pivot:      uniformLocation(shaderProg, "pivot"),
+		pivotIndex: uniformLocation(shaderProg, "pivot_index"),
+		partition:  uniformLocation(shaderProg, "partition_mode"),
+	}
+}
+
+func (locs digitUniforms) set(pass radixPass) {
+	var partition uint32
+	if pass.partition {
+		partition = 1
+	} else if pass.selectIndex {
+		partition = 2
+	}
+	gl.Uniform1ui(locs.offset, pass.offset)
+	gl.Uniform1ui(locs.keyMask, pass.keyMask)
+	gl.Uniform1ui(locs.keyPrefix, pass.keyPrefix)
+	gl.Uniform1ui(locs.pivot, pass.pivot)
+	gl.Uniform1ui(locs.pivotIndex, pass.pivotIndex)
+	gl.Uniform1ui(locs.partition, partition)
 }
 
 type shaderSettings struct {
 	WorkGroupItems uint32
 	WorkGroupSize  uint32
+	ItemsPerThread uint32
 	PaddingBefore  uint32
 	PaddingAfter   uint32
+	LocalSortItems uint32
+	// Size of a record and of a sort entry of SortSegments in 32-bit words, and the word offsets of the key fields.
+	RecordWords uint32
+	EntryWords  uint32
+	KeyWords    []uint32
+	// Shaders are compiled as GLSL ES 3.10 instead of GLSL 4.30, set when the current context is an OpenGL ES context.
+	ES bool
 }
 
 func loadShader(name string, settings shaderSettings) uint32 {
+	settings.ES = gl.IsES()
+	return loadProgram(name, renderShader(name, settings))
+}
+
+// renderShader returns the source of the embedded shader template name for settings. Line endings are normalized to
+// LF, as the templates may be checked out with CRLF line endings.
+func renderShader(name string, settings shaderSettings) string {
 	var buf bytes.Buffer
 	if err := shaderTemplate.ExecuteTemplate(&buf, name, settings); err != nil {
 		panic(fmt.Sprintf("failed to parse embedded shader %v template: %v", name, err))
 	}
-	shader := rl.CompileShader(buf.String(), rl.ComputeShader)
-	shaderProg := rl.LoadComputeShaderProgram(shader)
-	if shaderProg == 0 {
-		panic(fmt.Sprintf("invalid shader program %v", name))
-	}
-	return shaderProg
+	return strings.ReplaceAll(buf.String(), "\r\n", "\n")
 }
 
 type SortSettings struct {
@@ -105,6 +252,37 @@ type SortSettings struct {
 	// Bytes of padding before the key in bytes, must be divisible by 4
 	// Default value: 0
 	KeyOffset uint32
+	// Key fields in priority order, most significant key first. When defined, KeyOffset is ignored.
+	// Default value: single 32-bit key at KeyOffset
+	Keys []SortKey
+	// Maximum length of arrays sorted by a single work group in shared memory, rounded up to a multiple of ValuesPerWorkGroup.
+	// Shared memory of 8 bytes per value is required.
+	// Default value: 4 * ValuesPerWorkGroup, or the largest size fitting the shared memory of the device if smaller
+	LocalSortSize uint32
+	// Exclusive upper bound of the keys sorted by CountingSort, such as the count of grid cells.
+	// Not used by RadixSort.
+	MaxKey uint32
+	// Count of records in each block of CountingSort.SortStable, rounded up to a multiple of the work group size.
+	// Each block is scattered by a single work group and has its own histogram of 4 * MaxKey bytes, so smaller blocks
+	// keep more work groups busy at the cost of larger histograms.
+	// Not used by RadixSort.
+	// Default value: 2048, or the smallest size fitting the histograms of Capacity records to the shader storage block
+	// size of the device if larger
+	StableBlockSize uint32
+	// Count of values scanned by each thread of the work groups, rounded up to a power of 2 and at most ValuesPerWorkGroup.
+	// Larger values use smaller work groups, with more sequential work per thread.
+	// Default value: 2
+	ItemsPerThread uint32
+}
+
+// SortKey describes a single key field of the input data.
+type SortKey struct {
+	// Bytes of padding before the key in bytes, must be divisible by 4.
+	Offset uint32
+	// Count of the least significant bits of the key used for sorting, rounded up to a multiple of 2.
+	// Higher bits are ignored, so the key is sorted only by its Bits lowest bits.
+	// Default value: 32
+	Bits uint32
 }
 
 func NewSettings(cap uint32) SortSettings {
@@ -128,6 +306,34 @@ func (settings SortSettings) WithKeyOffset(offset uint32) SortSettings {
 	return settings
 }
 
+// WithKeys sets the key fields used for lexicographic sorting, most significant key first.
+func (settings SortSettings) WithKeys(keys ...SortKey) SortSettings {
+	settings.Keys = keys
+	return settings
+}
+
+func (settings SortSettings) WithLocalSortSize(size uint32) SortSettings {
+	settings.LocalSortSize = size
+	return settings
+}
+
+func (settings SortSettings) WithItemsPerThread(count uint32) SortSettings {
+	settings.ItemsPerThread = count
+	return settings
+}
+
+// WithMaxKey sets the exclusive upper bound of the keys sorted by CountingSort.
+func (settings SortSettings) WithMaxKey(maxKey uint32) SortSettings {
+	settings.MaxKey = maxKey
+	return settings
+}
+
+// WithStableBlockSize sets the count of records in each block of CountingSort.SortStable.
+func (settings SortSettings) WithStableBlockSize(size uint32) SortSettings {
+	settings.StableBlockSize = size
+	return settings
+}
+
 func (settings SortSettings) getValuesPerWorkGroup() uint32 {
 	if settings.ValuesPerWorkGroup == 0 {
 		return 256
@@ -135,6 +341,17 @@ func (settings SortSettings) getValuesPerWorkGroup() uint32 {
 	return nextPow2(settings.ValuesPerWorkGroup)
 }
 
+func (settings SortSettings) getItemsPerThread() uint32 {
+	if settings.ItemsPerThread == 0 {
+		return 2
+	}
+	itemsPerThread := nextPow2(settings.ItemsPerThread)
+	if itemsPerThread > settings.getValuesPerWorkGroup() {
+		panic("ItemsPerThread must be at most ValuesPerWorkGroup")
+	}
+	return itemsPerThread
+}
+
 func (settings SortSettings) getCapacity() uint32 {
 	if settings.Capacity == 0 {
 		panic("SortSettings.Capacity must be defined")
@@ -142,6 +359,35 @@ func (settings SortSettings) getCapacity() uint32 {
 	return multipleOf(settings.Capacity, settings.getValuesPerWorkGroup())
 }
 
+func (settings SortSettings) getLocalSortSize() uint32 {
+	valuesPerWorkGroup := settings.getValuesPerWorkGroup()
+	if settings.LocalSortSize == 0 {
+		return 4 * valuesPerWorkGroup
+	}
+	return multipleOf(settings.LocalSortSize, valuesPerWorkGroup)
+}
+
+func (settings SortSettings) getMaxKey() uint32 {
+	if settings.MaxKey == 0 {
+		panic("SortSettings.MaxKey must be defined")
+	}
+	return settings.MaxKey
+}
+
+func (settings SortSettings) getStableBlockSize() uint32 {
+	workGroupSize := settings.getShaderSettings().WorkGroupSize
+	if settings.StableBlockSize == 0 {
+		return multipleOf(2048, workGroupSize)
+	}
+	return multipleOf(settings.StableBlockSize, workGroupSize)
+}
+
+// getMaxStableBlocks returns the count of blocks of CountingSort.SortStable for Capacity records.
+func (settings SortSettings) getMaxStableBlocks() uint32 {
+	blockSize := settings.getStableBlockSize()
+	return min(multipleOf(settings.getCapacity(), blockSize)/blockSize, maxWorkGroupCount)
+}
+
 func (settings SortSettings) getInputDataSize() uint32 {
 	if settings.KeyOffset%4 != 0 {
 		panic("KeyOffset must be divisible by 4")
@@ -158,65 +404,86 @@ func (settings SortSettings) getKeyOffset() uint32 {
 	return settings.KeyOffset
 }
 
-func New(settings SortSettings) *RadixSort {
+func (settings SortSettings) getKeys() []SortKey {
+	if len(settings.Keys) == 0 {
+		return []SortKey{{Offset: settings.getKeyOffset(), Bits: 32}}
+	}
+	keys := make([]SortKey, len(settings.Keys))
+	for i, key := range settings.Keys {
+		if key.Offset%4 != 0 {
+			panic("SortKey.Offset must be divisible by 4")
+		}
+		if key.Bits > 32 {
+			panic("SortKey.Bits must be at most 32")
+		}
+		if key.Bits == 0 {
+			key.Bits = 32
+		}
+		key.Bits = multipleOf(key.Bits, 2)
+		keys[i] = key
+	}
+	return keys
+}
+
+// getShaderSettings returns shader settings for the most significant key.
+func (settings SortSettings) getShaderSettings() shaderSettings {
+	return settings.getKeyShaderSettings(settings.getKeys()[0])
+}
+
+func (settings SortSettings) getKeyShaderSettings(key SortKey) shaderSettings {
 	valuesPerWorkGroup := settings.getValuesPerWorkGroup()
-	capacity := settings.getCapacity()
 	inputDataSize := settings.getInputDataSize()
-	keyOffset := settings.getKeyOffset()
+	keyOffset := key.Offset
 
 	// InputDataSize must be able to fit offset (N1 bytes) key (4 bytes)
 	if keyOffset+4 > inputDataSize {
 		panic("InputDataSize is not large enough to fit offset and key")
 	}
 	paddingAfter := inputDataSize - keyOffset - 4
+	itemsPerThread := settings.getItemsPerThread()
 
-	internalSettings := shaderSettings{
+	return shaderSettings{
 		WorkGroupItems: valuesPerWorkGroup,
-		WorkGroupSize:  valuesPerWorkGroup / 2,
+		WorkGroupSize:  valuesPerWorkGroup / itemsPerThread,
+		ItemsPerThread: itemsPerThread,
 		PaddingBefore:  keyOffset / 4,
 		PaddingAfter:   paddingAfter / 4,
+		LocalSortItems: settings.getLocalSortSize(),
+		RecordWords:    inputDataSize / 4,
+	}
+}
+
+// New creates radix sort for settings. Panics if settings do not fit the limits of the current OpenGL context,
+// see SortSettings.ValidateFor.
+func New(settings SortSettings) *RadixSort {
+	settings = settings.forDevice()
+	valuesPerWorkGroup := settings.getValuesPerWorkGroup()
+	capacity := settings.getCapacity()
+	inputDataSize := settings.getInputDataSize()
+	internalSettings := settings.getShaderSettings()
+
+	// Each key field gets its own radix scan and scatter shaders with the key at the correct offset of InputData.
+	sortKeys := settings.getKeys()
+	keys := make([]radixKey, len(sortKeys))
+	for i, key := range sortKeys {
+		keys[i] = newRadixKey(settings.getKeyShaderSettings(key), key.Bits)
 	}
 
-	radixScanProg := loadShader("shaders/radix_scan.glsl", internalSettings)
-	shaderRadixScanUniformInput := rl.GetLocationUniform(radixScanProg, "n_input")
-	shaderRadixScanUniformWorkGroups := rl.GetLocationUniform(radixScanProg, "n_workgroups")
-	shaderRadixScanUniformOffset := rl.GetLocationUniform(radixScanProg, "offset")
-	prefixSumProg := loadShader("shaders/prefix_sum.glsl", internalSettings)
-	shaderPrefixSumUniformInput := rl.GetLocationUniform(prefixSumProg, "n_input")
-	shaderPrefixSumUniformInputOffset := rl.GetLocationUniform(prefixSumProg, "input_offset")
-	shaderPrefixSumUniformSumOffset := rl.GetLocationUniform(prefixSumProg, "sum_offset")
-	addBlockProg := loadShader("shaders/add_block.glsl", internalSettings)
-	shaderAddBlockUniformInputOffset := rl.GetLocationUniform(addBlockProg, "input_offset")
-	shaderAddBlockUniformSumOffset := rl.GetLocationUniform(addBlockProg, "sum_offset")
-	scatterProg := loadShader("shaders/scatter.glsl", internalSettings)
-	shaderScatterUniformInput := rl.GetLocationUniform(scatterProg, "n_input")
-	shaderScatterUniformWorkGroups := rl.GetLocationUniform(scatterProg, "n_workgroups")
-	shaderScatterUniformOffset := rl.GetLocationUniform(scatterProg, "offset")
-
-	input := rl.LoadShaderBuffer(capacity*inputDataSize, nil, rl.DynamicCopy)
-	localPrefix := rl.LoadShaderBuffer(capacity*inputDataSize, nil, rl.DynamicCopy)
-	blockSum := rl.LoadShaderBuffer(max(nextPow2(capacity)/valuesPerWorkGroup, valuesPerWorkGroup)*inputDataSize*2*4, nil, rl.DynamicCopy)
+	input := loadBuffer(capacity*inputDataSize, nil)
+	localPrefix := loadBuffer(capacity*inputDataSize, nil)
+	// Block sums hold the count of each of the 4 digits for every work group.
+	blockSums := newPrefixSum(internalSettings, capacity/valuesPerWorkGroup*4)
 
 	return &RadixSort{
-		shaderRadixScan:                   radixScanProg,
-		shaderRadixScanUniformInput:       shaderRadixScanUniformInput,
-		shaderRadixScanUniformWorkGroups:  shaderRadixScanUniformWorkGroups,
-		shaderRadixScanUniformOffset:      shaderRadixScanUniformOffset,
-		shaderPrefixSum:                   prefixSumProg,
-		shaderPrefixSumUniformInput:       shaderPrefixSumUniformInput,
-		shaderPrefixSumUniformInputOffset: shaderPrefixSumUniformInputOffset,
-		shaderPrefixSumUniformSumOffset:   shaderPrefixSumUniformSumOffset,
-		shaderAddBlock:                    addBlockProg,
-		shaderAddBlockUniformInputOffset:  shaderAddBlockUniformInputOffset,
-		shaderAddBlockUniformSumOffset:    shaderAddBlockUniformSumOffset,
-		shaderScatter:                     scatterProg,
-		shaderScatterUniformInput:         shaderScatterUniformInput,
-		shaderScatterUniformOffset:        shaderScatterUniformOffset,
-		shaderScatterUniformWorkGroups:    shaderScatterUniformWorkGroups,
-		inputBuffer:                       input,
-		localPrefixBuffer:                 localPrefix,
-		blockSumBuffer:                    blockSum,
-		valuesPerWorkGroup:                valuesPerWorkGroup,
+		keys:               keys,
+		inputBuffer:        input,
+		localPrefixBuffer:  localPrefix,
+		blockSums:          blockSums,
+		valuesPerWorkGroup: valuesPerWorkGroup,
+		inputDataSize:      inputDataSize,
+		capacity:           capacity,
+		localSortSize:      settings.getLocalSortSize(),
+		settings:           settings,
 	}
 }
 
@@ -224,15 +491,44 @@ func (pfs *RadixSort) Sort(input_buf uint32, length int) {
 	if length <= 0 {
 		return
 	}
+	defer saveState().restore()
 	dataLen := uint32(length)
+	// Data fitting in a single work group is sorted in shared memory with a single dispatch per key.
+	// Local sort is a stable radix sort on the same digits, so the result is identical to the global sort.
+	if dataLen <= pfs.localSortSize {
+		pfs.uploadSegments([]Segment{{Offset: 0, Length: dataLen}})
+		for i := len(pfs.keys) - 1; i >= 0; i-- {
+			pfs.localSort(&pfs.keys[i], input_buf, 1)
+		}
+		return
+	}
 	dataLenMultiple := multipleOf(dataLen, pfs.valuesPerWorkGroup)
 	workGroups := dataLenMultiple / pfs.valuesPerWorkGroup
 
-	var offset uint32
 	buffer1 := input_buf
 	buffer2 := pfs.inputBuffer
 	log.Printf("Dispatching %d workgroups, length: %d", workGroups, dataLenMultiple)
-	for offset = 0; offset < 32; offset += 2 {
+	// Keys are sorted from the least significant to the most significant one. As each pass is stable,
+	// ordering of the less significant keys is preserved between records with equal keys.
+	for i := len(pfs.keys) - 1; i >= 0; i-- {
+		pfs.sortKey(&pfs.keys[i], buffer1, buffer2, dataLen, workGroups)
+		if pfs.keys[i].bits/2%2 == 1 {
+			buffer1, buffer2 = buffer2, buffer1
+		}
+	}
+	// Odd count of passes leaves the result in the internal buffer.
+	if buffer1 != input_buf {
+		gl.MemoryBarrier(gl.BUFFER_UPDATE_BARRIER_BIT)
+		copyBuffer(input_buf, buffer1, 0, 0, dataLen*pfs.inputDataSize)
+		gl.MemoryBarrier(gl.SHADER_STORAGE_BARRIER_BIT)
+	}
+}
+
+// sortKey sorts the data by a single key, starting from buffer1. Result is left in buffer1 if the count of passes is even
+// and in buffer2 otherwise.
+func (pfs *RadixSort) sortKey(key *radixKey, buffer1 uint32, buffer2 uint32, dataLen uint32, workGroups uint32) {
+	for offset := uint32(0); offset < key.bits; offset += 2 {
+		pass := radixPass{offset: offset}
 		// Scan the input and build local prefix sum for each block, and build block sum 4*workgroups large.
 		// Block sum contains count of each possible digit 0-3 layed out as
 		// [
@@ -241,38 +537,46 @@ func (pfs *RadixSort) Sort(input_buf uint32, length int) {
 		//   [two_count_for_block0,  	two_count_for_block1,  	...,  two_count_for_blockN-1  ]
 		//   [three_count_for_block0,	three_count_for_block1,	...,  three_count_for_blockN-1]
 		// ]
-		rl.EnableShader(pfs.shaderRadixScan)
-		rl.SetUniform(pfs.shaderRadixScanUniformInput, uniformValues(dataLen), int32(rl.ShaderUniformUint))
-		rl.SetUniform(pfs.shaderRadixScanUniformWorkGroups, uniformValues(workGroups), int32(rl.ShaderUniformUint))
-		rl.SetUniform(pfs.shaderRadixScanUniformOffset, uniformValues(offset), int32(rl.ShaderUniformUint))
-		rl.BindShaderBuffer(buffer1, 1)
-		rl.BindShaderBuffer(pfs.localPrefixBuffer, 2)
-		rl.BindShaderBuffer(pfs.blockSumBuffer, 3)
-		rl.ComputeShaderDispatch(workGroups, 1, 1)
-		rl.DisableShader()
-		gl.MemoryBarrier(gl.SHADER_STORAGE_BARRIER_BIT)
+		pfs.radixScan(key, buffer1, dataLen, workGroups, pass)
 
 		// Perform prefix sum scan of the block sum memory.
 		// This gives us indices for each digit globally two scatter on the next stage.
-		pfs.prefixSum(workGroups)
+		pfs.blockSums.scan(workGroups * 4)
 
 		// Scatter input to the output buffer based on local prefix sum (ordering between same digits within a block)
 		// and prefix summed block sum.
-		rl.EnableShader(pfs.shaderScatter)
-		rl.SetUniform(pfs.shaderScatterUniformInput, uniformValues(dataLen), int32(rl.ShaderUniformUint))
-		rl.SetUniform(pfs.shaderScatterUniformWorkGroups, uniformValues(workGroups), int32(rl.ShaderUniformUint))
-		rl.SetUniform(pfs.shaderScatterUniformOffset, uniformValues(offset), int32(rl.ShaderUniformUint))
-		rl.BindShaderBuffer(buffer1, 1)
-		rl.BindShaderBuffer(buffer2, 2)
-		rl.BindShaderBuffer(pfs.localPrefixBuffer, 3)
-		rl.BindShaderBuffer(pfs.blockSumBuffer, 4)
-		rl.ComputeShaderDispatch(workGroups, 1, 1)
-		rl.DisableShader()
-		gl.MemoryBarrier(gl.SHADER_STORAGE_BARRIER_BIT)
+		pfs.scatter(key, buffer1, buffer2, dataLen, workGroups, pass)
 		buffer1, buffer2 = buffer2, buffer1
 	}
 }
 
+func (pfs *RadixSort) radixScan(key *radixKey, buf uint32, dataLen uint32, workGroups uint32, pass radixPass) {
+	gl.UseProgram(key.shaderRadixScan)
+	gl.Uniform1ui(key.shaderRadixScanUniformInput, dataLen)
+	gl.Uniform1ui(key.shaderRadixScanUniformWorkGroups, workGroups)
+	key.shaderRadixScanUniformDigit.set(pass)
+	bindBuffer(buf, 1)
+	bindBuffer(pfs.localPrefixBuffer, 2)
+	bindBuffer(pfs.blockSums.buffer, 3)
+	gl.DispatchCompute(workGroups, 1, 1)
+	gl.UseProgram(0)
+	gl.MemoryBarrier(gl.SHADER_STORAGE_BARRIER_BIT)
+}
+
+func (pfs *RadixSort) scatter(key *radixKey, src uint32, dst uint32, dataLen uint32, workGroups uint32, pass radixPass) {
+	gl.UseProgram(key.shaderScatter)
+	gl.Uniform1ui(key.shaderScatterUniformInput, dataLen)
+	gl.Uniform1ui(key.shaderScatterUniformWorkGroups, workGroups)
+	key.shaderScatterUniformDigit.set(pass)
+	bindBuffer(src, 1)
+	bindBuffer(dst, 2)
+	bindBuffer(pfs.localPrefixBuffer, 3)
+	bindBuffer(pfs.blockSums.buffer, 4)
+	gl.DispatchCompute(workGroups, 1, 1)
+	gl.UseProgram(0)
+	gl.MemoryBarrier(gl.SHADER_STORAGE_BARRIER_BIT)
+}
+
 func multipleOf(x, multiple uint32) uint32 {
 	if mod := x % multiple; mod > 0 {
 		x += multiple - mod
@@ -280,66 +584,20 @@ func multipleOf(x, multiple uint32) uint32 {
 	return x
 }
 
-func (pfs *RadixSort) prefixSum(workGroups uint32) {
-	initialSize := nextPow2(multipleOf(workGroups*4, pfs.valuesPerWorkGroup))
-	sumBufferSize := initialSize
-	sumBufferOffset := uint32(0)
-	sumBufferSumOffset := sumBufferSize
-	inputDataSize := workGroups * 4
-
-	for sumBufferSize >= pfs.valuesPerWorkGroup {
-		pfs.prefixSumIteration(sumBufferSize, sumBufferOffset, sumBufferSumOffset, inputDataSize)
-		sumBufferOffset += sumBufferSize
-		sumBufferSumOffset = sumBufferOffset + (sumBufferSize / pfs.valuesPerWorkGroup)
-		sumBufferSize /= pfs.valuesPerWorkGroup
-		inputDataSize = sumBufferSize
-	}
-	if initialSize <= pfs.valuesPerWorkGroup {
-		return
+func (pfs *RadixSort) Free() {
+	for i := range pfs.keys {
+		pfs.keys[i].free()
 	}
-	pfs.prefixSumIteration(sumBufferSize, sumBufferOffset, sumBufferSumOffset, sumBufferSize)
-	sumBufferSize *= pfs.valuesPerWorkGroup
-	sumBufferOffset -= sumBufferSize
-	sumBufferSumOffset = sumBufferOffset + (sumBufferSize)
 
-	for sumBufferSize <= initialSize {
-		pfs.addBlockIteration(sumBufferSize, sumBufferOffset, sumBufferSumOffset)
-		sumBufferSize *= pfs.valuesPerWorkGroup
-		sumBufferOffset -= sumBufferSize
-		sumBufferSumOffset = sumBufferOffset + (sumBufferSize)
+	unloadBuffer(pfs.inputBuffer)
+	pfs.blockSums.free()
+	unloadBuffer(pfs.localPrefixBuffer)
+	if pfs.segmentTableBuffer != 0 {
+		unloadBuffer(pfs.segmentTableBuffer)
+	}
+	if pfs.long != nil {
+		pfs.long.free()
 	}
-}
-
-func (pfs *RadixSort) prefixSumIteration(sumBufferSize uint32, sumBufferOffset uint32, sumBufferSumOffset uint32, dataLenth uint32) {
-	rl.EnableShader(pfs.shaderPrefixSum)
-	rl.SetUniform(pfs.shaderPrefixSumUniformInput, uniformValues(dataLenth), int32(rl.ShaderUniformUint))
-	rl.SetUniform(pfs.shaderPrefixSumUniformInputOffset, uniformValues(sumBufferOffset), int32(rl.ShaderUniformUint))
-	rl.SetUniform(pfs.shaderPrefixSumUniformSumOffset, uniformValues(sumBufferSumOffset), int32(rl.ShaderUniformUint))
-	rl.BindShaderBuffer(pfs.blockSumBuffer, 1)
-	rl.ComputeShaderDispatch(max(sumBufferSize/pfs.valuesPerWorkGroup, 1), 1, 1)
-	rl.DisableShader()
-	gl.MemoryBarrier(gl.SHADER_STORAGE_BARRIER_BIT)
-}
-
-func (pfs *RadixSort) addBlockIteration(sumBufferSize uint32, sumBufferOffset uint32, sumBufferSumOffset uint32) {
-	rl.EnableShader(pfs.shaderAddBlock)
-	rl.SetUniform(pfs.shaderAddBlockUniformInputOffset, uniformValues(sumBufferOffset), int32(rl.ShaderUniformUint))
-	rl.SetUniform(pfs.shaderAddBlockUniformSumOffset, uniformValues(sumBufferSumOffset), int32(rl.ShaderUniformUint))
-	rl.BindShaderBuffer(pfs.blockSumBuffer, 1)
-	rl.ComputeShaderDispatch(max(sumBufferSize/pfs.valuesPerWorkGroup, 1), 1, 1)
-	rl.DisableShader()
-	gl.MemoryBarrier(gl.SHADER_STORAGE_BARRIER_BIT)
-}
-
-func (pfs *RadixSort) Free() {
-	rl.UnloadShaderProgram(pfs.shaderRadixScan)
-	rl.UnloadShaderProgram(pfs.shaderPrefixSum)
-	rl.UnloadShaderProgram(pfs.shaderAddBlock)
-	rl.UnloadShaderProgram(pfs.shaderScatter)
-
-	rl.UnloadShaderBuffer(pfs.inputBuffer)
-	rl.UnloadShaderBuffer(pfs.blockSumBuffer)
-	rl.UnloadShaderBuffer(pfs.localPrefixBuffer)
 }
 
 func nextPow2(v uint32) uint32 {
@@ -353,20 +611,12 @@ func nextPow2(v uint32) uint32 {
 	return v
 }
 
-func uniformValues[T any](values ...T) []float32 {
-	ret := make([]float32, len(values))
-	for i, v := range values {
-		ret[i] = *(*float32)(unsafe.Pointer(&v))
-	}
-	return ret
-}
-
 func printBuffer(name string, buf uint32, length uint32, offset uint32, split int) {
 	temp := make([]uint32, length)
 	if split <= 0 {
 		split = int(length)
 	}
-	rl.ReadShaderBuffer(buf, unsafe.Pointer(unsafe.SliceData(temp)), length*4, offset*4)
+	readBuffer(buf, unsafe.Pointer(unsafe.SliceData(temp)), length*4, offset*4)
 	log.Printf("Buffer %v\n%v", name, splitBuffer(temp, split))
 }
 
@@ -4,9 +4,13 @@ package gsort_test
 
 import (
 	"cmp"
+	"fmt"
+	"io"
 	"iter"
+	"log"
 	"math"
 	"math/rand"
+	"os"
 	"runtime"
 	"slices"
 	"testing"
@@ -51,6 +55,24 @@ func TestSortSmallWorkGroup(t *testing.T) {
 	}
 }
 
+func TestSortItemsPerThread(t *testing.T) {
+	const capacity = 1 << 16
+	initialize(t)
+
+	r := rand.New(rand.NewSource(0))
+	for _, itemsPerThread := range []uint32{1, 4, 16} {
+		gs := gsort.New(gsort.NewSettings(capacity).WithValuesPerWorkGroup(1024).WithItemsPerThread(itemsPerThread))
+		sb := rl.LoadShaderBuffer(capacity*4, nil, rl.DynamicCopy)
+
+		for td := range generateTestData(initializeRandomValues, r, values(1, 1023, 4096, 4097, 10000, capacity)) {
+			gpuSort(gs, td.actual, sb)
+			arraysEqual(t, td.expected, td.actual)
+		}
+		rl.UnloadShaderBuffer(sb)
+		gs.Free()
+	}
+}
+
 func TestSortSmallSameValue(t *testing.T) {
 	const capacity = 8192
 	initialize(t)
@@ -310,6 +332,243 @@ func TestSortStabilityPaddingBeforeAndAfter(t *testing.T) {
 	}
 }
 
+func TestSortStabilityLocalSort(t *testing.T) {
+	type TestData struct {
+		data1 uint32
+		key   uint32
+		data2 uint32
+	}
+	const capacity = 1 << 12
+	initialize(t)
+
+	r := rand.New(rand.NewSource(0))
+	gs := gsort.New(gsort.NewSettings(capacity).WithKeyOffset(4).WithInputDataSize(12).WithLocalSortSize(1024))
+	defer gs.Free()
+
+	sb := rl.LoadShaderBuffer(capacity*uint32(unsafe.Sizeof(TestData{})), nil, rl.DynamicCopy)
+	defer rl.UnloadShaderBuffer(sb)
+
+	// Lengths around the local sort size use both the local and the global sort.
+	for _, length := range []int{1, 2, 3, 255, 256, 257, 1000, 1023, 1024, 1025, capacity} {
+		testDataExpected := make([]TestData, length)
+		testDataActual := make([]TestData, length)
+		for i := range testDataExpected {
+			testDataExpected[i] = TestData{
+				data1: uint32(i),
+				key:   r.Uint32() % 64,
+				data2: r.Uint32(),
+			}
+			testDataActual[i] = testDataExpected[i]
+		}
+		slices.SortStableFunc(testDataExpected, func(a, b TestData) int {
+			return cmp.Compare(a.key, b.key)
+		})
+		var p runtime.Pinner
+		p.Pin(unsafe.SliceData(testDataActual))
+		rl.UpdateShaderBuffer(sb, unsafe.Pointer(unsafe.SliceData(testDataActual)), uint32(length)*uint32(unsafe.Sizeof(TestData{})), 0)
+		p.Unpin()
+
+		gs.Sort(sb, length)
+
+		p.Pin(unsafe.SliceData(testDataActual))
+		rl.ReadShaderBuffer(sb, unsafe.Pointer(unsafe.SliceData(testDataActual)), uint32(length)*uint32(unsafe.Sizeof(TestData{})), 0)
+		p.Unpin()
+
+		for i := range testDataExpected {
+			if testDataExpected[i] != testDataActual[i] {
+				t.Fatalf("actual value differs at index %d for length %d, actual %d != %d expected", i, length, testDataActual[i], testDataExpected[i])
+			}
+		}
+	}
+}
+
+func TestSortMultipleKeys(t *testing.T) {
+	type TestData struct {
+		id       uint32
+		material uint32
+		payload  uint32
+		cell     uint32
+	}
+	const capacity = 1 << 20
+	initialize(t)
+
+	r := rand.New(rand.NewSource(0))
+	gs := gsort.New(gsort.NewSettings(capacity).WithInputDataSize(16).WithKeys(
+		gsort.SortKey{Offset: 4, Bits: 3},
+		gsort.SortKey{Offset: 12, Bits: 14},
+		gsort.SortKey{Offset: 0},
+	))
+	defer gs.Free()
+
+	sb := rl.LoadShaderBuffer(capacity*uint32(unsafe.Sizeof(TestData{})), nil, rl.DynamicCopy)
+	defer rl.UnloadShaderBuffer(sb)
+
+	testDataExpected := make([]TestData, capacity)
+	testDataActual := make([]TestData, capacity)
+	for i := range testDataExpected {
+		testDataExpected[i] = TestData{
+			id:       r.Uint32() % 64,
+			material: r.Uint32() % 8,
+			payload:  uint32(i),
+			cell:     r.Uint32() % (1 << 14),
+		}
+		testDataActual[i] = testDataExpected[i]
+	}
+	slices.SortStableFunc(testDataExpected, func(a, b TestData) int {
+		return cmp.Or(cmp.Compare(a.material, b.material), cmp.Compare(a.cell, b.cell), cmp.Compare(a.id, b.id))
+	})
+	var p runtime.Pinner
+	p.Pin(unsafe.SliceData(testDataActual))
+	rl.UpdateShaderBuffer(sb, unsafe.Pointer(unsafe.SliceData(testDataActual)), capacity*uint32(unsafe.Sizeof(TestData{})), 0)
+	p.Unpin()
+
+	gs.Sort(sb, capacity)
+
+	p.Pin(unsafe.SliceData(testDataActual))
+	rl.ReadShaderBuffer(sb, unsafe.Pointer(unsafe.SliceData(testDataActual)), capacity*uint32(unsafe.Sizeof(TestData{})), 0)
+	p.Unpin()
+
+	for i := range testDataExpected {
+		if testDataExpected[i] != testDataActual[i] {
+			t.Fatalf("actual value differs at index %d, actual %d != %d expected", i, testDataActual[i], testDataExpected[i])
+		}
+	}
+}
+
+func TestSortRestoresGLState(t *testing.T) {
+	const capacity = 1 << 16
+	initialize(t)
+
+	r := rand.New(rand.NewSource(0))
+	gs := gsort.New(gsort.NewSettings(capacity))
+	defer gs.Free()
+
+	sb := rl.LoadShaderBuffer(capacity*4, nil, rl.DynamicCopy)
+	defer rl.UnloadShaderBuffer(sb)
+	csb := rl.LoadShaderBuffer(capacity*4, nil, rl.DynamicCopy)
+	defer rl.UnloadShaderBuffer(csb)
+	hostBuffer := rl.LoadShaderBuffer(1024, nil, rl.DynamicCopy)
+	defer rl.UnloadShaderBuffer(hostBuffer)
+
+	// Data is uploaded before setting up the host state, as raylib unbinds the buffers it updates.
+	td := initializeRandomValues(capacity, r)
+	var p runtime.Pinner
+	p.Pin(unsafe.SliceData(td.actual))
+	rl.UpdateShaderBuffer(sb, unsafe.Pointer(unsafe.SliceData(td.actual)), capacity*4, 0)
+	rl.UpdateShaderBuffer(csb, unsafe.Pointer(unsafe.SliceData(td.actual)), capacity*4, 0)
+	p.Unpin()
+
+	program := rl.GetShaderIdDefault()
+	gl.UseProgram(program)
+	gl.BindBufferBase(gl.SHADER_STORAGE_BUFFER, 1, hostBuffer)
+	gl.BindBufferBase(gl.SHADER_STORAGE_BUFFER, 2, 0)
+	gl.BindBufferRange(gl.SHADER_STORAGE_BUFFER, 3, hostBuffer, 256, 512)
+	gl.BindBuffer(gl.SHADER_STORAGE_BUFFER, hostBuffer)
+	gl.BindBuffer(gl.COPY_READ_BUFFER, hostBuffer)
+	gl.BindBuffer(gl.COPY_WRITE_BUFFER, 0)
+
+	gs.Sort(sb, capacity)
+	// Counting sort always copies the result back to the input buffer. It is created here to check that loading its
+	// buffers keeps the bindings as well.
+	cs := gsort.NewCountingSort(gsort.NewSettings(capacity).WithMaxKey(16))
+	defer cs.Free()
+	cs.Sort(csb, capacity)
+
+	var v int32
+	var v64 int64
+	gl.GetIntegerv(gl.CURRENT_PROGRAM, &v)
+	assert.Equal(t, int32(program), v)
+	gl.GetIntegerv(gl.SHADER_STORAGE_BUFFER_BINDING, &v)
+	assert.Equal(t, int32(hostBuffer), v)
+	gl.GetIntegeri_v(gl.SHADER_STORAGE_BUFFER_BINDING, 1, &v)
+	assert.Equal(t, int32(hostBuffer), v)
+	gl.GetIntegeri_v(gl.SHADER_STORAGE_BUFFER_BINDING, 2, &v)
+	assert.Equal(t, int32(0), v)
+	gl.GetIntegeri_v(gl.SHADER_STORAGE_BUFFER_BINDING, 3, &v)
+	assert.Equal(t, int32(hostBuffer), v)
+	gl.GetInteger64i_v(gl.SHADER_STORAGE_BUFFER_START, 3, &v64)
+	assert.Equal(t, int64(256), v64)
+	gl.GetInteger64i_v(gl.SHADER_STORAGE_BUFFER_SIZE, 3, &v64)
+	assert.Equal(t, int64(512), v64)
+	gl.GetIntegerv(gl.COPY_READ_BUFFER_BINDING, &v)
+	assert.Equal(t, int32(hostBuffer), v)
+	gl.GetIntegerv(gl.COPY_WRITE_BUFFER_BINDING, &v)
+	assert.Equal(t, int32(0), v)
+	gl.UseProgram(0)
+	gl.BindBuffer(gl.COPY_READ_BUFFER, 0)
+
+	p.Pin(unsafe.SliceData(td.actual))
+	rl.ReadShaderBuffer(sb, unsafe.Pointer(unsafe.SliceData(td.actual)), capacity*4, 0)
+	p.Unpin()
+	arraysEqual(t, td.expected, td.actual)
+}
+
+func TestExecutorSort(t *testing.T) {
+	const capacity = 1 << 16
+	initialize(t)
+
+	r := rand.New(rand.NewSource(0))
+	e := gsort.NewExecutor()
+	gs := gsort.New(gsort.NewSettings(capacity))
+	defer gs.Free()
+	sb := rl.LoadShaderBuffer(capacity*4, nil, rl.DynamicCopy)
+	defer rl.UnloadShaderBuffer(sb)
+
+	td := initializeRandomValues(capacity, r)
+	// Simulation goroutine submits the jobs, while this goroutine owns the GL context.
+	go func() {
+		defer e.Close()
+		gsort.Upload(e, sb, td.actual, 0)
+		e.Sort(gs, sb, capacity)
+		sorted, err := gsort.Download[uint32](e, sb, capacity, 0).Wait()
+		assert.NoError(t, err)
+		td.actual = sorted
+	}()
+	e.Run()
+
+	arraysEqual(t, td.expected, td.actual)
+}
+
+// BenchmarkSort sorts random keys in records of different sizes. Run with -benchtime=Nx for the large inputs.
+func BenchmarkSort(b *testing.B) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+	r := rand.New(rand.NewSource(0))
+	for _, length := range []int{1 << 20, 1 << 24} {
+		for _, inputDataSize := range []uint32{4, 8, 16} {
+			b.Run(fmt.Sprintf("n=%d/size=%d", length, inputDataSize), func(b *testing.B) {
+				// Sub-benchmarks run on their own goroutines, so the context is created on the thread of each sub-benchmark.
+				initialize(b)
+				gs := gsort.New(gsort.NewSettings(uint32(length)).WithInputDataSize(inputDataSize))
+				defer gs.Free()
+				sb := rl.LoadShaderBuffer(uint32(length)*inputDataSize, nil, rl.DynamicCopy)
+				defer rl.UnloadShaderBuffer(sb)
+
+				data := make([]uint32, length*int(inputDataSize/4))
+				for i := range data {
+					data[i] = r.Uint32()
+				}
+				var p runtime.Pinner
+				p.Pin(unsafe.SliceData(data))
+				defer p.Unpin()
+
+				b.SetBytes(int64(length) * int64(inputDataSize))
+				b.ResetTimer()
+				for range b.N {
+					// Sorted input would make the scatter writes coalesced regardless of the local shuffle.
+					b.StopTimer()
+					rl.UpdateShaderBuffer(sb, unsafe.Pointer(unsafe.SliceData(data)), uint32(len(data))*4, 0)
+					gl.Finish()
+					b.StartTimer()
+
+					gs.Sort(sb, length)
+					gl.Finish()
+				}
+			})
+		}
+	}
+}
+
 func arraysEqual(t *testing.T, expected, actual []uint32) {
 	for i := range expected {
 		if expected[i] != actual[i] {
@@ -422,8 +681,8 @@ func initialize(t testing.TB) {
 	runtime.LockOSThread()
 	rl.SetTraceLogLevel(rl.LogWarning)
 	rl.InitWindow(600, 600, "Radix Sort Test")
-	if err := gl.Init(); err != nil {
-		assert.NoError(t, err, "gl.Init() should succeed")
+	if err := gsort.InitGL(); err != nil {
+		assert.NoError(t, err, "gsort.InitGL() should succeed")
 	}
 }
 
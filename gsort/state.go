@@ -0,0 +1,65 @@
+package gsort
+
+import (
+	"github.com/MatiasLyyra/fluid/gsort/internal/gl"
+)
+
+// maxBinding is the highest shader storage buffer binding point used by the shaders.
+const maxBinding = 4
+
+// glState is the GL state changed by the dispatches: shader storage buffer bindings, copy buffer bindings and the
+// current program.
+type glState struct {
+	program uint32
+	buffer  uint32
+	// Buffers bound to the copy targets, used by buffer copies.
+	copyReadBuffer  uint32
+	copyWriteBuffer uint32
+	// Buffer, offset and size bound to each indexed binding point up to maxBinding. Size 0 means the whole buffer.
+	bindings [maxBinding + 1]struct {
+		buffer uint32
+		offset int
+		size   int
+	}
+}
+
+// saveState returns the current GL state, so that the state of the host application can be restored after dispatching
+// with defer saveState().restore().
+func saveState() glState {
+	var state glState
+	var v int32
+	var v64 int64
+	gl.GetIntegerv(gl.CURRENT_PROGRAM, &v)
+	state.program = uint32(v)
+	gl.GetIntegerv(gl.SHADER_STORAGE_BUFFER_BINDING, &v)
+	state.buffer = uint32(v)
+	gl.GetIntegerv(gl.COPY_READ_BUFFER_BINDING, &v)
+	state.copyReadBuffer = uint32(v)
+	gl.GetIntegerv(gl.COPY_WRITE_BUFFER_BINDING, &v)
+	state.copyWriteBuffer = uint32(v)
+	for i := range state.bindings {
+		binding := &state.bindings[i]
+		gl.GetIntegeri_v(gl.SHADER_STORAGE_BUFFER_BINDING, uint32(i), &v)
+		binding.buffer = uint32(v)
+		gl.GetInteger64i_v(gl.SHADER_STORAGE_BUFFER_START, uint32(i), &v64)
+		binding.offset = int(v64)
+		gl.GetInteger64i_v(gl.SHADER_STORAGE_BUFFER_SIZE, uint32(i), &v64)
+		binding.size = int(v64)
+	}
+	return state
+}
+
+func (state glState) restore() {
+	for i, binding := range state.bindings {
+		if binding.size == 0 {
+			gl.BindBufferBase(gl.SHADER_STORAGE_BUFFER, uint32(i), binding.buffer)
+		} else {
+			gl.BindBufferRange(gl.SHADER_STORAGE_BUFFER, uint32(i), binding.buffer, binding.offset, binding.size)
+		}
+	}
+	// Indexed binding also changes the generic binding, so it is restored last.
+	gl.BindBuffer(gl.SHADER_STORAGE_BUFFER, state.buffer)
+	gl.BindBuffer(gl.COPY_READ_BUFFER, state.copyReadBuffer)
+	gl.BindBuffer(gl.COPY_WRITE_BUFFER, state.copyWriteBuffer)
+	gl.UseProgram(state.program)
+}
@@ -0,0 +1,175 @@
+package gsort
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+	"unsafe"
+
+	"github.com/MatiasLyyra/fluid/gsort/internal/gl"
+)
+
+// TuneCachePath is the JSON file where the results of Tune are cached. Empty path uses gsort/tune.json in the user cache
+// directory.
+var TuneCachePath string
+
+// tuneRuns is the count of timed sorts per candidate, of which the fastest is used.
+const tuneRuns = 3
+
+// tuneCache maps GL renderer strings to the tuned settings of the device.
+type tuneCache map[string][]tuneResult
+
+type tuneResult struct {
+	Capacity           uint32 `json:"capacity"`
+	InputDataSize      uint32 `json:"input_data_size"`
+	ValuesPerWorkGroup uint32 `json:"values_per_work_group"`
+	ItemsPerThread     uint32 `json:"items_per_thread"`
+	// Duration of sorting capacity records with the settings.
+	Duration time.Duration `json:"duration"`
+}
+
+func (result tuneResult) settings() SortSettings {
+	return NewSettings(result.Capacity).
+		WithInputDataSize(result.InputDataSize).
+		WithValuesPerWorkGroup(result.ValuesPerWorkGroup).
+		WithItemsPerThread(result.ItemsPerThread)
+}
+
+// Tune returns the fastest settings for sorting capacity records of inputDataSize bytes with RadixSort on the current
+// device. Key offset of the returned settings is 0, but other key layouts can be set with the same sort parameters.
+//
+// Candidate values of ValuesPerWorkGroup and ItemsPerThread fitting the device limits are benchmarked by sorting random
+// keys. Results are cached in TuneCachePath by GL renderer string, so the benchmark is run only once for each device,
+// capacity and input data size. Error is returned only if no candidate fits the device limits; failing to read or write
+// the cache causes the benchmark to run again on the next call.
+func Tune(capacity, inputDataSize uint32) (SortSettings, error) {
+	renderer := gl.GoStr(gl.GetString(gl.RENDERER))
+	path, pathErr := tuneCachePath()
+	cache := tuneCache{}
+	if pathErr == nil {
+		cache, _ = readTuneCache(path)
+	}
+	for _, result := range cache[renderer] {
+		if result.Capacity == capacity && result.InputDataSize == inputDataSize {
+			return result.settings(), nil
+		}
+	}
+
+	best, err := benchmarkCandidates(capacity, inputDataSize)
+	if err != nil {
+		return SortSettings{}, err
+	}
+	if pathErr == nil {
+		cache[renderer] = append(cache[renderer], best)
+		_ = writeTuneCache(path, cache)
+	}
+	return best.settings(), nil
+}
+
+func tuneCachePath() (string, error) {
+	if TuneCachePath != "" {
+		return TuneCachePath, nil
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "gsort", "tune.json"), nil
+}
+
+func readTuneCache(path string) (tuneCache, error) {
+	cache := tuneCache{}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return cache, nil
+	}
+	if err != nil {
+		return cache, err
+	}
+	if err := json.Unmarshal(data, &cache); err != nil {
+		return tuneCache{}, err
+	}
+	return cache, nil
+}
+
+func writeTuneCache(path string, cache tuneCache) error {
+	data, err := json.MarshalIndent(cache, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
+
+// tuneCandidates returns the candidate settings fitting the device limits.
+func tuneCandidates(capacity, inputDataSize uint32, limits DeviceLimits) []SortSettings {
+	var candidates []SortSettings
+	for _, valuesPerWorkGroup := range []uint32{64, 128, 256, 512, 1024, 2048} {
+		for _, itemsPerThread := range []uint32{2, 4, 8} {
+			settings := NewSettings(capacity).
+				WithInputDataSize(inputDataSize).
+				WithValuesPerWorkGroup(valuesPerWorkGroup).
+				WithItemsPerThread(itemsPerThread)
+			if settings.ValidateFor(limits) == nil {
+				candidates = append(candidates, settings)
+			}
+		}
+	}
+	return candidates
+}
+
+func benchmarkCandidates(capacity, inputDataSize uint32) (tuneResult, error) {
+	candidates := tuneCandidates(capacity, inputDataSize, QueryDeviceLimits())
+	if len(candidates) == 0 {
+		return tuneResult{}, fmt.Errorf("gsort: no candidate settings for capacity %d and input data size %d fit the device limits", capacity, inputDataSize)
+	}
+
+	r := rand.New(rand.NewSource(0))
+	data := make([]uint32, capacity*inputDataSize/4)
+	for i := range data {
+		data[i] = r.Uint32()
+	}
+	var p runtime.Pinner
+	p.Pin(unsafe.SliceData(data))
+	defer p.Unpin()
+	size := uint32(len(data)) * 4
+	buf := loadBuffer(size, unsafe.Pointer(unsafe.SliceData(data)))
+	defer unloadBuffer(buf)
+
+	var best tuneResult
+	for _, settings := range candidates {
+		gs := New(settings)
+		// The first sort includes one-time driver costs, such as compiling the shaders for the device.
+		gs.Sort(buf, int(capacity))
+		duration := time.Duration(1<<63 - 1)
+		for range tuneRuns {
+			// Sorted input would make the scatter writes coalesced, so each run sorts the same random data.
+			updateBuffer(buf, unsafe.Pointer(unsafe.SliceData(data)), size, 0)
+			gl.Finish()
+			start := time.Now()
+			gs.Sort(buf, int(capacity))
+			gl.Finish()
+			duration = min(duration, time.Since(start))
+		}
+		gs.Free()
+
+		if best.Capacity == 0 || duration < best.Duration {
+			best = tuneResult{
+				Capacity:           capacity,
+				InputDataSize:      inputDataSize,
+				ValuesPerWorkGroup: settings.ValuesPerWorkGroup,
+				ItemsPerThread:     settings.ItemsPerThread,
+				Duration:           duration,
+			}
+		}
+	}
+	return best, nil
+}
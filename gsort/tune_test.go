@@ -0,0 +1,30 @@
+//go:build opengl43
+
+package gsort_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/MatiasLyyra/fluid/gsort"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTune(t *testing.T) {
+	const capacity = 1 << 16
+	initialize(t)
+
+	gsort.TuneCachePath = filepath.Join(t.TempDir(), "tune.json")
+	defer func() { gsort.TuneCachePath = "" }()
+
+	settings, err := gsort.Tune(capacity, 8)
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(capacity), settings.Capacity)
+	assert.Equal(t, uint32(8), settings.InputDataSize)
+	assert.NoError(t, settings.ValidateFor(gsort.QueryDeviceLimits()))
+	assert.FileExists(t, gsort.TuneCachePath)
+
+	cached, err := gsort.Tune(capacity, 8)
+	assert.NoError(t, err)
+	assert.Equal(t, settings, cached)
+}
@@ -2,22 +2,22 @@ package main
 
 import (
 	"log"
-	"math"
 	"math/rand"
 
 	"github.com/MatiasLyyra/fluid/simulation"
 	rl "github.com/gen2brain/raylib-go/raylib"
 )
 
-const MaxNeighbours = 32
-const ParticleCount = 1 << 14
 const Width = 768
 const Height = 768
-const Radius = 0.04
 
-const NoNeighbour = math.MaxUint32
+// SubSteps is the count of PBF steps per frame. PBF stays stable with steps of a few milliseconds, so a few steps per
+// frame keep the simulation in real time at 60 FPS.
+const SubSteps = 3
 
-type NeighbourList [ParticleCount * MaxNeighbours]int
+// MaxFrameTime caps the simulated time per frame, so that slow frames slow the simulation down instead of taking steps
+// too long to stay stable.
+const MaxFrameTime = 1.0 / 60
 
 const vertexShader = `
 #version 430
@@ -48,34 +48,36 @@ void main()
 }
 `
 
-func HashPosition(pos, rangeLow, rangeHigh simulation.Vector2, step float32) uint32 {
-	pos = pos.Clamp(rangeLow, rangeHigh)
-	gridX := uint32((pos.X - rangeLow.X) / step)
-	gridY := uint32((pos.Y - rangeLow.Y) / step)
-	return interleave2d(gridX) | interleave2d(gridY)<<1
-}
-
-func interleave2d(v uint32) uint32 {
-	v = (v ^ (v << 8)) & 0x00ff00ff
-	v = (v ^ (v << 4)) & 0x0f0f0f0f
-	v = (v ^ (v << 2)) & 0x33333333
-	return (v ^ (v << 1)) & 0x55555555
+// damBreak returns a block of columns × rows particles at rest density in the lower left corner of the domain, jittered
+// to break the symmetry of the grid.
+func damBreak(params simulation.Parameters, columns, rows int) []simulation.Particle {
+	spacing := params.ParticleSpacing()
+	particles := make([]simulation.Particle, 0, columns*rows)
+	for y := range rows {
+		for x := range columns {
+			particles = append(particles, simulation.Particle{
+				Position: simulation.Vector2{
+					X: params.DomainMin.X + spacing*(float32(x)+0.5+0.1*rand.Float32()),
+					Y: params.DomainMin.Y + spacing*(float32(y)+0.5+0.1*rand.Float32()),
+				},
+			})
+		}
+	}
+	return particles
 }
 
 func main() {
+	params := simulation.DefaultParameters()
+	// Particles twice the spacing of the defaults apart keep the CPU solver in real time.
+	params.SmoothingRadius = 0.04
+	params.ParticleMass = params.RestDensity * (params.SmoothingRadius / 2) * (params.SmoothingRadius / 2)
+	params.Walls = &simulation.Walls{Restitution: 0.1, Friction: 0.1}
+	params.Solver = simulation.DefaultPBF()
+	radius := params.ParticleSpacing() / 2
 
-	particles := make([]simulation.Particle, ParticleCount)
+	world := simulation.NewWorld(params, damBreak(params, 20, 30))
+	world.SetBoundary(params.DomainBoundary())
 
-	for i := range particles {
-		particles[i] = simulation.Particle{
-			Position: simulation.Vector2{
-				X: rand.Float32(),
-				Y: rand.Float32(),
-			},
-		}
-		// particles[i].Code = HashPosition(particles[i].Position, simulation.Vector2{X: 0, Y: 0}, simulation.Vector2{X: 1, Y: 1}, 0.02)
-	}
-	// slices.SortFunc(particles, func(a, b simulation.Particle) int { return cmp.Compare(a.Code, b.Code) })
 	rl.InitWindow(Width, Height, "Fluid")
 	rl.SetTargetFPS(60)
 
@@ -87,10 +89,20 @@ func main() {
 	// gl.BindVertexArray(model.Meshes.VaoID)
 
 	log.Printf("Data: %+v", rl.GetShaderLocationAttrib(shader, "fragPos"))
-}
 
-func smoothingKernel(rSq, h float32) float32 {
-	norm := math.Pi * float32(math.Pow(float64(h), 8)) / 4
-	diff := max(h*h-rSq, 0)
-	return norm * diff * diff * diff
+	for !rl.WindowShouldClose() {
+		dt := min(rl.GetFrameTime(), MaxFrameTime) / SubSteps
+		for range SubSteps {
+			world.Step(dt)
+		}
+
+		rl.BeginDrawing()
+		rl.ClearBackground(rl.Black)
+		for _, p := range world.Particles {
+			// Simulation y axis points up, screen y axis down.
+			rl.DrawCircleV(rl.Vector2{X: p.Position.X * Width, Y: (1 - p.Position.Y) * Height}, radius*Width, rl.SkyBlue)
+		}
+		rl.EndDrawing()
+	}
+	rl.CloseWindow()
 }
@@ -0,0 +1,170 @@
+package simulation
+
+import (
+	"math"
+
+	"github.com/MatiasLyyra/fluid/simulation/kernel"
+)
+
+// Walls keep the particles inside the domain by moving particles that crossed its edges back onto the edge and
+// reflecting their velocity.
+type Walls struct {
+	// Restitution is the fraction of the normal velocity kept when bouncing off a wall, from 0 for no bounce to 1 for a
+	// perfectly elastic bounce.
+	Restitution float32
+	// Friction is the Coulomb friction coefficient of the walls. Tangential speed is reduced by Friction times the change
+	// of the normal speed, but not past zero.
+	Friction float32
+}
+
+// collide returns the speed away from the wall and the tangential velocity after hitting a wall with speed normal
+// towards the wall.
+func (w Walls) collide(normal, tangent float32) (float32, float32) {
+	out := w.Restitution * normal
+	reduction := min(abs(tangent), w.Friction*(normal+out))
+	return out, tangent - float32(math.Copysign(float64(reduction), float64(tangent)))
+}
+
+// applyWalls moves the particles outside the domain back to its edges.
+func (w *World) applyWalls() {
+	walls := w.Parameters.Walls
+	if walls == nil {
+		return
+	}
+	low, high := w.Parameters.DomainMin, w.Parameters.DomainMax
+	for i := range w.Particles {
+		p := &w.Particles[i]
+		if p.Position.X < low.X {
+			p.Position.X = low.X
+			if p.Velocity.X < 0 {
+				p.Velocity.X, p.Velocity.Y = walls.collide(-p.Velocity.X, p.Velocity.Y)
+			}
+		} else if p.Position.X > high.X {
+			p.Position.X = high.X
+			if p.Velocity.X > 0 {
+				var out float32
+				out, p.Velocity.Y = walls.collide(p.Velocity.X, p.Velocity.Y)
+				p.Velocity.X = -out
+			}
+		}
+		if p.Position.Y < low.Y {
+			p.Position.Y = low.Y
+			if p.Velocity.Y < 0 {
+				p.Velocity.Y, p.Velocity.X = walls.collide(-p.Velocity.Y, p.Velocity.X)
+			}
+		} else if p.Position.Y > high.Y {
+			p.Position.Y = high.Y
+			if p.Velocity.Y > 0 {
+				var out float32
+				out, p.Velocity.X = walls.collide(p.Velocity.Y, p.Velocity.X)
+				p.Velocity.Y = -out
+			}
+		}
+	}
+}
+
+// BoundaryLine returns boundary particles from a to b, including both ends, at most spacing apart.
+func BoundaryLine(a, b Vector2, spacing float32) []Vector2 {
+	if spacing <= 0 {
+		panic("boundary particle spacing must be positive")
+	}
+	segments := max(int(math.Ceil(float64(b.Subtract(a).Length()/spacing))), 1)
+	positions := make([]Vector2, segments+1)
+	for i := range positions {
+		t := float32(i) / float32(segments)
+		positions[i] = a.Add(b.Subtract(a).Scale(t))
+	}
+	return positions
+}
+
+// BoundaryRectangle returns boundary particles along the edges of the rectangle from low to high, at most spacing
+// apart.
+func BoundaryRectangle(low, high Vector2, spacing float32) []Vector2 {
+	corners := [4]Vector2{low, {X: high.X, Y: low.Y}, high, {X: low.X, Y: high.Y}}
+	var positions []Vector2
+	for i, corner := range corners {
+		line := BoundaryLine(corner, corners[(i+1)%len(corners)], spacing)
+		// Each corner is the start of one edge.
+		positions = append(positions, line[:len(line)-1]...)
+	}
+	return positions
+}
+
+// DomainBoundary returns boundary particles enclosing the domain, spaced like the fluid particles at rest density. The
+// particles are half of the particle spacing outside the domain, so particles kept at the edges by Walls do not
+// overlap them.
+func (p Parameters) DomainBoundary() []Vector2 {
+	spacing := p.ParticleSpacing()
+	margin := Vector2{X: spacing / 2, Y: spacing / 2}
+	return BoundaryRectangle(p.DomainMin.Subtract(margin), p.DomainMax.Add(margin), spacing)
+}
+
+// SetBoundary sets the static boundary particles of the world. Boundary particles contribute to the density of the
+// fluid and push the fluid away with its own pressure, as in Akinci et al., which prevents the density drop of fluid
+// particles near walls. Each boundary particle is weighted by the volume it represents, so the particles can be sampled
+// unevenly, but should be at most the fluid particle spacing apart to prevent leaking.
+//
+// References:
+//
+//  1. Akinci, Ihmsen, Akinci, Solenthaler & Teschner. (2012). Versatile rigid-fluid coupling for incompressible SPH.
+//     ACM TOG 31(4). 62:1-62:8.
+func (w *World) SetBoundary(positions []Vector2) {
+	w.boundary = resize(w.boundary, len(positions))
+	for i, pos := range positions {
+		w.boundary[i] = Particle{Position: pos}
+	}
+	// Search and masses are rebuilt by the next step.
+	w.boundarySearch = nil
+	w.boundaryMassParameters = nil
+}
+
+// boundaryMassParameters are the parameters the boundary masses depend on.
+type boundaryMassParameters struct {
+	radius        float32
+	restDensity   float32
+	densityKernel kernel.Type
+}
+
+// updateBoundary sorts the boundary particles for the neighbour search and calculates the fluid mass Ψ represented by
+// each boundary particle from the density of the boundary particles. Both are only rebuilt when the boundary or the
+// parameters they depend on have changed.
+func (w *World) updateBoundary(k Kernels) {
+	if len(w.boundary) == 0 {
+		return
+	}
+	h := w.Parameters.SmoothingRadius
+	if w.boundarySearch == nil || w.boundarySearch.low != w.Parameters.DomainMin || w.boundarySearch.high != w.Parameters.DomainMax || w.boundarySearch.radius != h {
+		w.boundarySearch = NewNeighbourSearch(w.Parameters.DomainMin, w.Parameters.DomainMax, h)
+		w.boundarySearch.sort(w.boundary)
+	}
+	params := boundaryMassParameters{
+		radius:        h,
+		restDensity:   w.Parameters.RestDensity,
+		densityKernel: w.Parameters.DensityKernel,
+	}
+	if w.boundaryMassParameters != nil && *w.boundaryMassParameters == params {
+		return
+	}
+	w.boundaryMassParameters = &params
+	w.boundaryMass = resize(w.boundaryMass, len(w.boundary))
+	for i, b := range w.boundary {
+		var density float32
+		w.boundarySearch.forEachNear(b.Position, w.boundary, func(j uint32) {
+			density += k.Density.W(b.Position.Subtract(w.boundary[j].Position).Length())
+		})
+		w.boundaryMass[i] = w.Parameters.RestDensity / density
+	}
+}
+
+// forEachBoundaryNeighbour calls fn for each boundary particle b within the smoothing radius of particle i, with the
+// offset from b to i and its length.
+func (w *World) forEachBoundaryNeighbour(i int, fn func(b int, r Vector2, dist float32)) {
+	if len(w.boundary) == 0 {
+		return
+	}
+	pi := w.Particles[i].Position
+	w.boundarySearch.forEachNear(pi, w.boundary, func(b uint32) {
+		r := pi.Subtract(w.boundary[b].Position)
+		fn(int(b), r, r.Length())
+	})
+}
@@ -0,0 +1,165 @@
+package simulation_test
+
+import (
+	"testing"
+
+	"github.com/MatiasLyyra/fluid/simulation"
+	"github.com/MatiasLyyra/fluid/simulation/kernel"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWallsReflectParticles(t *testing.T) {
+	params := simulation.DefaultParameters()
+	params.Gravity = simulation.Vector2{}
+	params.Walls = &simulation.Walls{Restitution: 0.5, Friction: 0.2}
+	world := simulation.NewWorld(params, []simulation.Particle{
+		{Position: simulation.Vector2{X: 0.5, Y: 0.0005}, Velocity: simulation.Vector2{X: 1, Y: -2}},
+		{Position: simulation.Vector2{X: 0.9995, Y: 0.5}, Velocity: simulation.Vector2{X: 2, Y: -1}},
+	})
+	world.Step(1e-3)
+
+	bottom := world.Particles[0]
+	assert.Zero(t, bottom.Position.Y)
+	assert.InDelta(t, 1, bottom.Velocity.Y, 1e-6)
+	// Friction takes 0.2 of the change of the normal velocity 2 + 1 from the tangential velocity.
+	assert.InDelta(t, 0.4, bottom.Velocity.X, 1e-6)
+
+	right := world.Particles[1]
+	assert.Equal(t, float32(1), right.Position.X)
+	assert.InDelta(t, -1, right.Velocity.X, 1e-6)
+	assert.InDelta(t, -0.4, right.Velocity.Y, 1e-6)
+}
+
+func TestWallsFrictionDoesNotReverseVelocity(t *testing.T) {
+	params := simulation.DefaultParameters()
+	params.Gravity = simulation.Vector2{}
+	params.Walls = &simulation.Walls{Friction: 10}
+	world := simulation.NewWorld(params, []simulation.Particle{
+		{Position: simulation.Vector2{X: 0.0005, Y: 0.5}, Velocity: simulation.Vector2{X: -1, Y: 0.5}},
+	})
+	world.Step(1e-3)
+	p := world.Particles[0]
+	assert.Zero(t, p.Position.X)
+	assert.Zero(t, p.Velocity)
+}
+
+func TestBoundaryRectangle(t *testing.T) {
+	positions := simulation.BoundaryRectangle(simulation.Vector2{}, simulation.Vector2{X: 2, Y: 1}, 0.3)
+	// Edges of length 2 and 1 are split to 7 and 4 segments.
+	assert.Len(t, positions, 2*7+2*4)
+	for i, pos := range positions {
+		next := positions[(i+1)%len(positions)]
+		assert.LessOrEqual(t, pos.Subtract(next).Length(), float32(0.3))
+		assert.True(t, pos.X == 0 || pos.X == 2 || pos.Y == 0 || pos.Y == 1)
+	}
+}
+
+// Boundary particles one particle spacing below a block of fluid make up for the missing fluid below the bottom row.
+func TestBoundaryParticlesCompensateDensityNearWall(t *testing.T) {
+	params := simulation.DefaultParameters()
+	spacing := params.ParticleSpacing()
+	const side = 10
+	density := func(boundary bool) (bottom, center float32) {
+		world := simulation.NewWorld(params, gridParticles(params, side))
+		if boundary {
+			line := simulation.BoundaryLine(simulation.Vector2{X: -0.05, Y: -spacing}, simulation.Vector2{X: 0.1, Y: -spacing}, spacing)
+			world.SetBoundary(line)
+		}
+		world.Step(0)
+		return world.Particles[side/2].Density, world.Particles[side/2*side+side/2].Density
+	}
+	bottom, center := density(false)
+	assert.Less(t, bottom, 0.9*center)
+	// Single layer of boundary particles at the spacing of the fluid overestimates the missing density, as the fluid
+	// particles next to the boundary are pushed further away at rest.
+	compensated, _ := density(true)
+	assert.Greater(t, compensated, bottom+(center-bottom)/2)
+}
+
+// Boundary masses are kept between steps, but recalculated when the parameters they depend on change.
+func TestBoundaryMassesFollowParameters(t *testing.T) {
+	params := simulation.DefaultParameters()
+	spacing := params.ParticleSpacing()
+	line := simulation.BoundaryLine(simulation.Vector2{X: -0.05, Y: -spacing}, simulation.Vector2{X: 0.1, Y: -spacing}, spacing)
+	densities := func(world *simulation.World) []float32 {
+		world.Step(0)
+		var densities []float32
+		for _, p := range world.Particles {
+			densities = append(densities, p.Density)
+		}
+		return densities
+	}
+
+	world := simulation.NewWorld(params, gridParticles(params, 10))
+	world.SetBoundary(line)
+	densities(world)
+	for _, change := range []func(*simulation.Parameters){
+		func(p *simulation.Parameters) { p.DensityKernel = kernel.CubicSpline },
+		func(p *simulation.Parameters) { p.RestDensity *= 2 },
+		func(p *simulation.Parameters) { p.SmoothingRadius *= 1.5 },
+	} {
+		change(&world.Parameters)
+		fresh := simulation.NewWorld(world.Parameters, gridParticles(params, 10))
+		fresh.SetBoundary(line)
+		assert.Equal(t, densities(fresh), densities(world))
+	}
+}
+
+// Fluid falling in a closed rectangle of boundary particles stays inside without walls.
+func TestBoundaryParticlesContainFluid(t *testing.T) {
+	params := iisphParameters()
+	params.Gravity = simulation.DefaultParameters().Gravity
+	particles := gridParticles(params, 20)
+	for i := range particles {
+		particles[i].Position = particles[i].Position.Add(simulation.Vector2{X: 0.01, Y: 0.05})
+	}
+	world := simulation.NewWorld(params, particles)
+	world.SetBoundary(simulation.BoundaryRectangle(simulation.Vector2{}, simulation.Vector2{X: 0.2, Y: 0.2}, params.ParticleSpacing()))
+	for range 300 {
+		world.Step(1e-3)
+	}
+	for _, p := range world.Particles {
+		assert.True(t, p.Position.X > 0 && p.Position.X < 0.2 && p.Position.Y > 0 && p.Position.Y < 0.2, "%v", p.Position)
+	}
+	assert.True(t, world.Convergence().Converged)
+}
+
+// Fluid resting on the bottom of the domain keeps rest density next to the wall.
+func TestDomainBoundaryRestingFluid(t *testing.T) {
+	params := iisphParameters()
+	params.Gravity = simulation.DefaultParameters().Gravity
+	params.DomainMax = simulation.Vector2{X: 0.2, Y: 0.2}
+	params.Walls = &simulation.Walls{}
+	spacing := params.ParticleSpacing()
+	// Layer of fluid filling the width of the domain.
+	const width = 40
+	var particles []simulation.Particle
+	for y := range 10 {
+		for x := range width {
+			particles = append(particles, simulation.Particle{
+				Position: simulation.Vector2{X: (float32(x) + 0.5) * spacing, Y: (float32(y) + 0.5) * spacing},
+			})
+		}
+	}
+	world := simulation.NewWorld(params, particles)
+	world.SetBoundary(params.DomainBoundary())
+	for range 200 {
+		world.Step(1e-3)
+	}
+	var bottom float32
+	for _, p := range world.Particles[:width] {
+		bottom += p.Density / width
+	}
+	assert.InEpsilon(t, params.RestDensity, bottom, 0.01)
+}
+
+func TestDomainBoundaryIsOutsideDomain(t *testing.T) {
+	params := simulation.DefaultParameters()
+	spacing := params.ParticleSpacing()
+	for _, pos := range params.DomainBoundary() {
+		outside := pos.X < params.DomainMin.X || pos.X > params.DomainMax.X || pos.Y < params.DomainMin.Y || pos.Y > params.DomainMax.Y
+		assert.True(t, outside, "%v", pos)
+		inner := pos.Clamp(params.DomainMin, params.DomainMax)
+		assert.LessOrEqual(t, pos.Subtract(inner).Length(), spacing)
+	}
+}
@@ -0,0 +1,59 @@
+package simulation
+
+import "math"
+
+// EquationOfState calculates the pressure of a particle from its density.
+type EquationOfState interface {
+	Pressure(density, restDensity float32) float32
+}
+
+// LinearEOS is the ideal gas equation of state p = k(ρ - ρ0).
+type LinearEOS struct {
+	// Stiffness k, which is the squared speed of sound in the fluid.
+	Stiffness float32
+	// ClampNegative clamps negative pressures to zero, so that particles below rest density do not attract each other.
+	ClampNegative bool
+}
+
+func (eos LinearEOS) Pressure(density, restDensity float32) float32 {
+	p := eos.Stiffness * (density - restDensity)
+	if eos.ClampNegative {
+		return max(p, 0)
+	}
+	return p
+}
+
+// TaitEOS is the Tait equation p = B((ρ/ρ0)^γ - 1) of weakly compressible SPH.
+type TaitEOS struct {
+	// Stiffness B.
+	Stiffness float32
+	// Exponent γ, usually 7 for water.
+	Exponent float32
+	// ClampNegative clamps negative pressures to zero, so that particles below rest density do not attract each other.
+	ClampNegative bool
+}
+
+func (eos TaitEOS) Pressure(density, restDensity float32) float32 {
+	ratio := float64(density / restDensity)
+	p := eos.Stiffness * float32(math.Pow(ratio, float64(eos.Exponent))-1)
+	if eos.ClampNegative {
+		return max(p, 0)
+	}
+	return p
+}
+
+// SoundSpeed returns the speed of sound keeping density variation around 1% for flow speeds up to maxSpeed. Density
+// variation is proportional to the squared Mach number, so the speed of sound is ten times the flow speed.
+func SoundSpeed(maxSpeed float32) float32 {
+	return 10 * maxSpeed
+}
+
+// LinearStiffness returns the stiffness of LinearEOS for speed of sound c.
+func LinearStiffness(c float32) float32 {
+	return c * c
+}
+
+// TaitStiffness returns the stiffness of TaitEOS with exponent gamma for speed of sound c.
+func TaitStiffness(c, restDensity, gamma float32) float32 {
+	return restDensity * c * c / gamma
+}
@@ -0,0 +1,48 @@
+package simulation_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/MatiasLyyra/fluid/simulation"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLinearEOS(t *testing.T) {
+	eos := simulation.LinearEOS{Stiffness: 100}
+	assert.Equal(t, float32(0), eos.Pressure(1000, 1000))
+	assert.Equal(t, float32(1000), eos.Pressure(1010, 1000))
+	assert.Equal(t, float32(-1000), eos.Pressure(990, 1000))
+
+	eos.ClampNegative = true
+	assert.Equal(t, float32(1000), eos.Pressure(1010, 1000))
+	assert.Equal(t, float32(0), eos.Pressure(990, 1000))
+}
+
+func TestTaitEOS(t *testing.T) {
+	eos := simulation.TaitEOS{Stiffness: 100, Exponent: 7}
+	assert.Zero(t, eos.Pressure(1000, 1000))
+	assert.InEpsilon(t, 100*(math.Pow(1.01, 7)-1), eos.Pressure(1010, 1000), 1e-5)
+	assert.Negative(t, eos.Pressure(990, 1000))
+
+	eos.ClampNegative = true
+	assert.Positive(t, eos.Pressure(1010, 1000))
+	assert.Zero(t, eos.Pressure(990, 1000))
+}
+
+// Both equations of state must have dp/dρ = c² at rest density with the stiffness of their helpers.
+func TestStiffnessFromSoundSpeed(t *testing.T) {
+	const restDensity = 1000
+	c := simulation.SoundSpeed(2)
+	assert.Equal(t, float32(20), c)
+
+	const dRho = 0.01
+	eoses := map[string]simulation.EquationOfState{
+		"linear": simulation.LinearEOS{Stiffness: simulation.LinearStiffness(c)},
+		"Tait":   simulation.TaitEOS{Stiffness: simulation.TaitStiffness(c, restDensity, 7), Exponent: 7},
+	}
+	for name, eos := range eoses {
+		slope := (eos.Pressure(restDensity+dRho, restDensity) - eos.Pressure(restDensity-dRho, restDensity)) / (2 * dRho)
+		assert.InEpsilon(t, c*c, slope, 1e-2, name)
+	}
+}
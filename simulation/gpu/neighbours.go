@@ -0,0 +1,239 @@
+package gpu
+
+import (
+	"runtime"
+	"unsafe"
+
+	gl "github.com/go-gl/gl/v4.3-core/gl"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+
+	"github.com/MatiasLyyra/fluid/gsort"
+	"github.com/MatiasLyyra/fluid/simulation"
+)
+
+// Record is a particle position with the Morton code of its grid cell and its index in the particle buffer. Records are
+// sorted by code to find the particles of each cell.
+type Record struct {
+	Position simulation.Vector2
+	Code     uint32
+	Index    uint32
+}
+
+// gridUniforms holds uniform locations of the grid template shared by the Morton code and gather shaders.
+type gridUniforms struct {
+	domainMin   int32
+	domainMax   int32
+	invCellSize int32
+}
+
+func getGridUniforms(shaderProg uint32) gridUniforms {
+	return gridUniforms{
+		domainMin:   rl.GetLocationUniform(shaderProg, "domain_min"),
+		domainMax:   rl.GetLocationUniform(shaderProg, "domain_max"),
+		invCellSize: rl.GetLocationUniform(shaderProg, "inv_cell_size"),
+	}
+}
+
+func (locs gridUniforms) set(low, high simulation.Vector2, invCellSize float32) {
+	rl.SetUniform(locs.domainMin, []float32{low.X, low.Y}, int32(rl.ShaderUniformVec2))
+	rl.SetUniform(locs.domainMax, []float32{high.X, high.Y}, int32(rl.ShaderUniformVec2))
+	rl.SetUniform(locs.invCellSize, []float32{invCellSize}, int32(rl.ShaderUniformFloat))
+}
+
+// NeighbourSearch is the GPU version of simulation.NeighbourSearch with identical output.
+//
+// Morton codes of the particles are written to records, which are sorted with gsort.RadixSort. The range of each cell
+// in the sorted records is then found, and the neighbours of each particle are gathered from the 3×3 cells around it to
+// a buffer of MaxNeighbours indices per particle.
+type NeighbourSearch struct {
+	shaderMorton                    uint32
+	shaderMortonUniformParticles    int32
+	shaderMortonUniformGrid         gridUniforms
+	shaderCellRange                 uint32
+	shaderCellRangeUniformParticles int32
+	shaderGather                    uint32
+	shaderGatherUniformParticles    int32
+	shaderGatherUniformRadiusSq     int32
+	shaderGatherUniformSortedOrder  int32
+	shaderGatherUniformGrid         gridUniforms
+	sort                            *gsort.RadixSort
+	recordBuffer                    uint32
+	cellBuffer                      uint32
+	neighbourBuffer                 uint32
+	overflowBuffer                  uint32
+	low, high                       simulation.Vector2
+	radius                          float32
+	cells                           uint32
+	capacity                        uint32
+	count                           uint32
+}
+
+// NewNeighbourSearch creates search for at most capacity particles in the domain from low to high with smoothing radius
+// radius.
+func NewNeighbourSearch(capacity int, low, high simulation.Vector2, radius float32) *NeighbourSearch {
+	if radius <= 0 {
+		panic("neighbour search radius must be positive")
+	}
+	if high.X < low.X || high.Y < low.Y {
+		panic("neighbour search domain is empty")
+	}
+	if (high.X-low.X)/radius >= 1<<16 || (high.Y-low.Y)/radius >= 1<<16 {
+		panic("neighbour search domain has too many cells for 32-bit Morton codes")
+	}
+	settings, err := gsort.SettingsFor[Record]("Code", uint32(capacity))
+	if err != nil {
+		panic(err)
+	}
+	shaderSettings := defaultShaderSettings()
+	mortonProg := loadShader("shaders/morton.glsl", shaderSettings)
+	cellRangeProg := loadShader("shaders/cell_range.glsl", shaderSettings)
+	gatherProg := loadShader("shaders/gather.glsl", shaderSettings)
+
+	// Morton code of the last cell is the largest code of the grid.
+	cells := simulation.HashPosition(high, low, high, radius) + 1
+	return &NeighbourSearch{
+		shaderMorton:                    mortonProg,
+		shaderMortonUniformParticles:    rl.GetLocationUniform(mortonProg, "n_particles"),
+		shaderMortonUniformGrid:         getGridUniforms(mortonProg),
+		shaderCellRange:                 cellRangeProg,
+		shaderCellRangeUniformParticles: rl.GetLocationUniform(cellRangeProg, "n_particles"),
+		shaderGather:                    gatherProg,
+		shaderGatherUniformParticles:    rl.GetLocationUniform(gatherProg, "n_particles"),
+		shaderGatherUniformRadiusSq:     rl.GetLocationUniform(gatherProg, "radius_sq"),
+		shaderGatherUniformSortedOrder:  rl.GetLocationUniform(gatherProg, "sorted_order"),
+		shaderGatherUniformGrid:         getGridUniforms(gatherProg),
+		sort:                            gsort.New(settings),
+		recordBuffer:                    rl.LoadShaderBuffer(uint32(capacity)*uint32(unsafe.Sizeof(Record{})), nil, rl.DynamicCopy),
+		cellBuffer:                      rl.LoadShaderBuffer(cells*8, nil, rl.DynamicCopy),
+		neighbourBuffer:                 rl.LoadShaderBuffer(uint32(capacity)*simulation.MaxNeighbours*4, nil, rl.DynamicCopy),
+		overflowBuffer:                  rl.LoadShaderBuffer(uint32(capacity)*4, nil, rl.DynamicCopy),
+		low:                             low,
+		high:                            high,
+		radius:                          radius,
+		cells:                           cells,
+		capacity:                        uint32(capacity),
+	}
+}
+
+// Find finds the neighbours of the first count particles of particleBuffer, including each particle itself.
+// Neighbours are written to NeighbourBuffer in the same order as simulation.NeighbourSearch.Find.
+func (s *NeighbourSearch) Find(particleBuffer uint32, count int) {
+	s.find(particleBuffer, count, false)
+}
+
+// FindSorted finds the neighbours like Find, but the neighbours of the record at each position of RecordBuffer are
+// written to that row of NeighbourBuffer as positions of the records. Particles copied in the order of the records can
+// then be processed with neighbours close to each other in memory.
+func (s *NeighbourSearch) FindSorted(particleBuffer uint32, count int) {
+	s.find(particleBuffer, count, true)
+}
+
+func (s *NeighbourSearch) find(particleBuffer uint32, count int, sortedOrder bool) {
+	if uint32(count) > s.capacity {
+		panic("count exceeds the capacity of NeighbourSearch")
+	}
+	s.count = uint32(count)
+	if count == 0 {
+		return
+	}
+	n := uint32(count)
+	invCellSize := 1 / s.radius
+
+	// Empty cells have start NoNeighbour.
+	empty := [2]uint32{simulation.NoNeighbour, 0}
+	gl.BindBuffer(gl.SHADER_STORAGE_BUFFER, s.cellBuffer)
+	gl.ClearBufferSubData(gl.SHADER_STORAGE_BUFFER, gl.RG32UI, 0, int(s.cells*8), gl.RG_INTEGER, gl.UNSIGNED_INT, unsafe.Pointer(&empty[0]))
+	gl.BindBuffer(gl.SHADER_STORAGE_BUFFER, 0)
+
+	rl.EnableShader(s.shaderMorton)
+	rl.SetUniform(s.shaderMortonUniformParticles, uniformValues(n), int32(rl.ShaderUniformUint))
+	s.shaderMortonUniformGrid.set(s.low, s.high, invCellSize)
+	rl.BindShaderBuffer(particleBuffer, 1)
+	rl.BindShaderBuffer(s.recordBuffer, 2)
+	rl.ComputeShaderDispatch(workGroups(n), 1, 1)
+	rl.DisableShader()
+	gl.MemoryBarrier(gl.SHADER_STORAGE_BARRIER_BIT)
+
+	// Radix sort is stable, so the records of each cell stay in the order of the particle indices.
+	s.sort.Sort(s.recordBuffer, count)
+
+	rl.EnableShader(s.shaderCellRange)
+	rl.SetUniform(s.shaderCellRangeUniformParticles, uniformValues(n), int32(rl.ShaderUniformUint))
+	rl.BindShaderBuffer(s.recordBuffer, 1)
+	rl.BindShaderBuffer(s.cellBuffer, 2)
+	rl.ComputeShaderDispatch(workGroups(n), 1, 1)
+	rl.DisableShader()
+	gl.MemoryBarrier(gl.SHADER_STORAGE_BARRIER_BIT)
+
+	rl.EnableShader(s.shaderGather)
+	rl.SetUniform(s.shaderGatherUniformParticles, uniformValues(n), int32(rl.ShaderUniformUint))
+	rl.SetUniform(s.shaderGatherUniformRadiusSq, []float32{s.radius * s.radius}, int32(rl.ShaderUniformFloat))
+	var sorted uint32
+	if sortedOrder {
+		sorted = 1
+	}
+	rl.SetUniform(s.shaderGatherUniformSortedOrder, uniformValues(sorted), int32(rl.ShaderUniformUint))
+	s.shaderGatherUniformGrid.set(s.low, s.high, invCellSize)
+	rl.BindShaderBuffer(s.recordBuffer, 1)
+	rl.BindShaderBuffer(s.cellBuffer, 2)
+	rl.BindShaderBuffer(s.neighbourBuffer, 3)
+	rl.BindShaderBuffer(s.overflowBuffer, 4)
+	rl.ComputeShaderDispatch(workGroups(n), 1, 1)
+	rl.DisableShader()
+	gl.MemoryBarrier(gl.SHADER_STORAGE_BARRIER_BIT)
+}
+
+// NeighbourBuffer returns the buffer of MaxNeighbours uint32 particle indices per particle, padded with NoNeighbour.
+// After FindSorted, rows and indices are positions of the sorted records instead.
+func (s *NeighbourSearch) NeighbourBuffer() uint32 {
+	return s.neighbourBuffer
+}
+
+// RecordBuffer returns the buffer of Records sorted by the Morton codes of their cells.
+func (s *NeighbourSearch) RecordBuffer() uint32 {
+	return s.recordBuffer
+}
+
+// CellBuffer returns the buffer of start and end indices of the sorted records of each cell, indexed by Morton code.
+// Start of empty cells is NoNeighbour.
+func (s *NeighbourSearch) CellBuffer() uint32 {
+	return s.cellBuffer
+}
+
+// Neighbours reads the neighbours found by the last Find or FindSorted from the GPU.
+func (s *NeighbourSearch) Neighbours() simulation.NeighbourList {
+	list := make(simulation.NeighbourList, s.count*simulation.MaxNeighbours)
+	readBuffer(s.neighbourBuffer, list)
+	return list
+}
+
+// Overflow reads the count of neighbours of each particle left out by the last Find from the GPU, or of each sorted
+// record after FindSorted.
+func (s *NeighbourSearch) Overflow() []uint32 {
+	overflow := make([]uint32, s.count)
+	readBuffer(s.overflowBuffer, overflow)
+	return overflow
+}
+
+func (s *NeighbourSearch) Free() {
+	rl.UnloadShaderProgram(s.shaderMorton)
+	rl.UnloadShaderProgram(s.shaderCellRange)
+	rl.UnloadShaderProgram(s.shaderGather)
+	s.sort.Free()
+	rl.UnloadShaderBuffer(s.recordBuffer)
+	rl.UnloadShaderBuffer(s.cellBuffer)
+	rl.UnloadShaderBuffer(s.neighbourBuffer)
+	rl.UnloadShaderBuffer(s.overflowBuffer)
+}
+
+func readBuffer[T any](buf uint32, data []T) {
+	if len(data) == 0 {
+		return
+	}
+	var p runtime.Pinner
+	p.Pin(unsafe.SliceData(data))
+	defer p.Unpin()
+	gl.MemoryBarrier(gl.BUFFER_UPDATE_BARRIER_BIT)
+	rl.ReadShaderBuffer(buf, unsafe.Pointer(unsafe.SliceData(data)), uint32(len(data))*uint32(unsafe.Sizeof(data[0])), 0)
+}
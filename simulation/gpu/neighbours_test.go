@@ -0,0 +1,96 @@
+//go:build opengl43
+
+package gpu_test
+
+import (
+	"math/rand"
+	"runtime"
+	"testing"
+	"unsafe"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+	"github.com/go-gl/gl/v4.3-core/gl"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/MatiasLyyra/fluid/simulation"
+	"github.com/MatiasLyyra/fluid/simulation/gpu"
+)
+
+func initialize(t testing.TB) {
+	runtime.GOMAXPROCS(1)
+	runtime.LockOSThread()
+	rl.SetTraceLogLevel(rl.LogWarning)
+	rl.InitWindow(600, 600, "GPU Simulation Test")
+	if err := gl.Init(); err != nil {
+		assert.NoError(t, err, "gl.Init() should succeed")
+	}
+}
+
+func loadParticles(particles []simulation.Particle) uint32 {
+	var p runtime.Pinner
+	p.Pin(unsafe.SliceData(particles))
+	defer p.Unpin()
+	size := uint32(len(particles)) * uint32(unsafe.Sizeof(simulation.Particle{}))
+	return rl.LoadShaderBuffer(size, unsafe.Pointer(unsafe.SliceData(particles)), rl.DynamicCopy)
+}
+
+func randomParticles(r *rand.Rand, n int, low, high simulation.Vector2) []simulation.Particle {
+	particles := make([]simulation.Particle, n)
+	for i := range particles {
+		particles[i].Position = simulation.Vector2{
+			X: low.X + r.Float32()*(high.X-low.X),
+			Y: low.Y + r.Float32()*(high.Y-low.Y),
+		}
+	}
+	return particles
+}
+
+func testMatchesCPU(t *testing.T, particles []simulation.Particle, low, high simulation.Vector2, radius float32) {
+	cpu := simulation.NewNeighbourSearch(low, high, radius)
+	cpu.Find(particles)
+
+	buf := loadParticles(particles)
+	defer rl.UnloadShaderBuffer(buf)
+	search := gpu.NewNeighbourSearch(len(particles), low, high, radius)
+	defer search.Free()
+	search.Find(buf, len(particles))
+
+	assert.Equal(t, cpu.List(), search.Neighbours())
+	overflow := search.Overflow()
+	for i := range particles {
+		assert.Equal(t, cpu.Overflow(i), overflow[i], "overflow of particle %d", i)
+	}
+}
+
+func TestNeighbourSearchMatchesCPU(t *testing.T) {
+	initialize(t)
+	r := rand.New(rand.NewSource(0))
+	low, high := simulation.Vector2{X: 0, Y: 0}, simulation.Vector2{X: 1, Y: 1}
+	for _, n := range []int{1, 100, 1 << 14, 50000} {
+		// Some particles are outside the domain and clamped to its border cells.
+		particles := randomParticles(r, n, simulation.Vector2{X: -0.05, Y: -0.05}, simulation.Vector2{X: 1.05, Y: 1.05})
+		testMatchesCPU(t, particles, low, high, 0.01)
+	}
+}
+
+func TestNeighbourSearchOverflowMatchesCPU(t *testing.T) {
+	initialize(t)
+	r := rand.New(rand.NewSource(1))
+	// Dense cluster overflows, while the rest of the particles do not.
+	particles := randomParticles(r, 1000, simulation.Vector2{X: 0.5, Y: 0.5}, simulation.Vector2{X: 0.52, Y: 0.52})
+	particles = append(particles, randomParticles(r, 1000, simulation.Vector2{}, simulation.Vector2{X: 1, Y: 1})...)
+	testMatchesCPU(t, particles, simulation.Vector2{}, simulation.Vector2{X: 1, Y: 1}, 0.02)
+}
+
+func TestNeighbourSearchParticleGrid(t *testing.T) {
+	initialize(t)
+	// Particles on a grid with the spacing of the default parameters have neighbours exactly at cell borders.
+	params := simulation.DefaultParameters()
+	spacing := params.ParticleSpacing()
+	const side = 128
+	particles := make([]simulation.Particle, side*side)
+	for i := range particles {
+		particles[i].Position = simulation.Vector2{X: 0.05 + spacing*float32(i%side), Y: 0.05 + spacing*float32(i/side)}
+	}
+	testMatchesCPU(t, particles, params.DomainMin, params.DomainMax, params.SmoothingRadius)
+}
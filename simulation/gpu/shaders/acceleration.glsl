@@ -0,0 +1,42 @@
+{{ template "version" . }}
+
+layout (local_size_x = {{ .WorkGroupSize }}) in;
+
+{{ template "particle_type" . }}
+{{ template "sph" . }}
+
+layout(std430, binding = 1) buffer particle_buffer {
+    Particle particles[];
+};
+
+layout(std430, binding = 2) buffer neighbour_buffer {
+    uint neighbours[];
+};
+
+layout(std430, binding = 3) buffer acceleration_buffer {
+    vec2 accelerations[];
+};
+
+void main()
+{
+    uint i = gl_GlobalInvocationID.x;
+    if (i >= n_particles) return;
+    Particle pi = particles[i];
+    float pressure_term = pi.pressure / (pi.density * pi.density);
+    vec2 pressure = vec2(0.0);
+    vec2 viscous = vec2(0.0);
+    for (uint k = 0u; k < MAX_NEIGHBOURS; k++)
+    {
+        uint j = neighbours[i * MAX_NEIGHBOURS + k];
+        if (j == NO_NEIGHBOUR) break;
+        Particle pj = particles[j];
+        vec2 r = pi.position - pj.position;
+        float dist = length(r);
+        if (j == i || dist == 0.0) continue;
+        vec2 gradient = r * (PRESSURE_GRADIENT(dist) / dist);
+        // Symmetric pressure force conserves momentum between each pair of particles.
+        pressure -= gradient * (mass * (pressure_term + pj.pressure / (pj.density * pj.density)));
+        viscous += viscosity_acceleration(pi, pj, r, dist);
+    }
+    accelerations[i] = pressure + viscous + gravity;
+}
@@ -0,0 +1,23 @@
+{{ template "version" . }}
+
+layout (local_size_x = {{ .WorkGroupSize }}) in;
+
+{{ template "particle_type" . }}
+{{ template "sph" . }}
+
+layout(std430, binding = 1) buffer particle_buffer {
+    Particle particles[];
+};
+
+layout(std430, binding = 3) buffer acceleration_buffer {
+    vec2 corrections[];
+};
+
+void main()
+{
+    uint i = gl_GlobalInvocationID.x;
+    if (i >= n_particles) return;
+    vec2 velocity = particles[i].velocity + corrections[i];
+    particles[i].velocity = velocity;
+    particles[i].position += velocity * dt;
+}
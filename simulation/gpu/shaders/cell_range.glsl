@@ -0,0 +1,32 @@
+{{ template "version" . }}
+
+layout (local_size_x = {{ .WorkGroupSize }}) in;
+
+uniform uint n_particles;
+
+{{ template "record_type" . }}
+
+layout(std430, binding = 1) buffer record_buffer {
+    Record records[];
+};
+
+// Start and end of the records of each cell, indexed by Morton code.
+layout(std430, binding = 2) buffer cell_buffer {
+    uvec2 cells[];
+};
+
+void main()
+{
+    uint i = gl_GlobalInvocationID.x;
+    if (i >= n_particles) return;
+    // Records are sorted by code, so the first and the last record of each cell write its range.
+    uint code = records[i].code;
+    if (i == 0u || records[i - 1u].code != code)
+    {
+        cells[code].x = i;
+    }
+    if (i == n_particles - 1u || records[i + 1u].code != code)
+    {
+        cells[code].y = i + 1u;
+    }
+}
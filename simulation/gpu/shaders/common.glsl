@@ -0,0 +1,49 @@
+{{ define "version" -}}
+#version 430
+{{- end }}
+
+{{ define "particle_type" }}
+struct Particle {
+    vec2 position;
+    vec2 velocity;
+    float density;
+    float pressure;
+};
+{{ end }}
+
+{{ define "record_type" }}
+// Particle position with the Morton code of its grid cell and its index in the particle buffer.
+struct Record {
+    vec2 position;
+    uint code;
+    uint index;
+};
+{{ end }}
+
+{{ define "grid" }}
+uniform vec2 domain_min;
+uniform vec2 domain_max;
+uniform float inv_cell_size;
+
+// Positions outside the domain are clamped to the cells at its border. Position is multiplied by the inverse of the
+// cell size, as division is not correctly rounded.
+uvec2 cell_of(vec2 pos)
+{
+    pos = clamp(pos, domain_min, domain_max);
+    return uvec2((pos - domain_min) * inv_cell_size);
+}
+
+// Spreads the lower 16 bits of v to the even bits.
+uint interleave(uint v)
+{
+    v = (v ^ (v << 8u)) & 0x00ff00ffu;
+    v = (v ^ (v << 4u)) & 0x0f0f0f0fu;
+    v = (v ^ (v << 2u)) & 0x33333333u;
+    return (v ^ (v << 1u)) & 0x55555555u;
+}
+
+uint morton_code(uvec2 cell)
+{
+    return interleave(cell.x) | (interleave(cell.y) << 1u);
+}
+{{ end }}
@@ -0,0 +1,30 @@
+{{ template "version" . }}
+
+layout (local_size_x = {{ .WorkGroupSize }}) in;
+
+{{ template "particle_type" . }}
+{{ template "sph" . }}
+
+layout(std430, binding = 1) buffer particle_buffer {
+    Particle particles[];
+};
+
+layout(std430, binding = 2) buffer neighbour_buffer {
+    uint neighbours[];
+};
+
+void main()
+{
+    uint i = gl_GlobalInvocationID.x;
+    if (i >= n_particles) return;
+    vec2 pos = particles[i].position;
+    float density = 0.0;
+    for (uint k = 0u; k < MAX_NEIGHBOURS; k++)
+    {
+        uint j = neighbours[i * MAX_NEIGHBOURS + k];
+        if (j == NO_NEIGHBOUR) break;
+        density += mass * DENSITY_W(length(pos - particles[j].position));
+    }
+    particles[i].density = density;
+    particles[i].pressure = equation_of_state(density);
+}
@@ -0,0 +1,77 @@
+{{ template "version" . }}
+
+layout (local_size_x = {{ .WorkGroupSize }}) in;
+
+#define MAX_NEIGHBOURS {{ .MaxNeighbours }}u
+#define NO_NEIGHBOUR 0xFFFFFFFFu
+
+uniform uint n_particles;
+uniform float radius_sq;
+// When set, neighbours are written for each sorted record as positions of the sorted records instead of particle
+// indices.
+uniform uint sorted_order;
+
+{{ template "record_type" . }}
+{{ template "grid" . }}
+
+layout(std430, binding = 1) buffer record_buffer {
+    Record records[];
+};
+
+layout(std430, binding = 2) buffer cell_buffer {
+    uvec2 cells[];
+};
+
+// MAX_NEIGHBOURS neighbours of each particle, padded with NO_NEIGHBOUR.
+layout(std430, binding = 3) buffer neighbour_buffer {
+    uint neighbours[];
+};
+
+// Count of neighbours of each particle left out of the list.
+layout(std430, binding = 4) buffer overflow_buffer {
+    uint overflows[];
+};
+
+void main()
+{
+    uint i = gl_GlobalInvocationID.x;
+    if (i >= n_particles) return;
+    Record record = records[i];
+    uvec2 cell = cell_of(record.position);
+    uvec2 max_cell = cell_of(domain_max);
+    uint row = sorted_order != 0u ? i : record.index;
+    uint base = row * MAX_NEIGHBOURS;
+    uint count = 0u;
+    uint overflow = 0u;
+
+    // Cells are scanned row by row and records by index within each cell, in the same order as the CPU search.
+    for (uint y = max(cell.y, 1u) - 1u; y <= min(cell.y + 1u, max_cell.y); y++)
+    {
+        for (uint x = max(cell.x, 1u) - 1u; x <= min(cell.x + 1u, max_cell.x); x++)
+        {
+            uvec2 range = cells[morton_code(uvec2(x, y))];
+            if (range.x == NO_NEIGHBOUR) continue;
+            for (uint j = range.x; j < range.y; j++)
+            {
+                // Results of operations on precise variables are not fused, so they are identical to the CPU.
+                precise vec2 d = record.position - records[j].position;
+                precise float dist_sq = d.x * d.x + d.y * d.y;
+                if (dist_sq >= radius_sq) continue;
+                if (count < MAX_NEIGHBOURS)
+                {
+                    neighbours[base + count] = sorted_order != 0u ? j : records[j].index;
+                    count++;
+                }
+                else
+                {
+                    overflow++;
+                }
+            }
+        }
+    }
+    for (uint j = count; j < MAX_NEIGHBOURS; j++)
+    {
+        neighbours[base + j] = NO_NEIGHBOUR;
+    }
+    overflows[row] = overflow;
+}
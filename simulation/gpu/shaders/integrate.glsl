@@ -0,0 +1,26 @@
+{{ template "version" . }}
+
+layout (local_size_x = {{ .WorkGroupSize }}) in;
+
+{{ template "particle_type" . }}
+{{ template "sph" . }}
+
+layout(std430, binding = 1) buffer particle_buffer {
+    Particle particles[];
+};
+
+layout(std430, binding = 3) buffer acceleration_buffer {
+    vec2 accelerations[];
+};
+
+// Semi-implicit Euler integration. With XSPH, positions are moved by advect.glsl after correcting the velocities.
+void main()
+{
+    uint i = gl_GlobalInvocationID.x;
+    if (i >= n_particles) return;
+    vec2 velocity = particles[i].velocity + accelerations[i] * dt;
+    particles[i].velocity = velocity;
+{{- if ne .Viscosity "xsph" }}
+    particles[i].position += velocity * dt;
+{{- end }}
+}
@@ -0,0 +1,25 @@
+{{ template "version" . }}
+
+layout (local_size_x = {{ .WorkGroupSize }}) in;
+
+uniform uint n_particles;
+
+{{ template "particle_type" . }}
+{{ template "record_type" . }}
+{{ template "grid" . }}
+
+layout(std430, binding = 1) buffer particle_buffer {
+    Particle particles[];
+};
+
+layout(std430, binding = 2) buffer record_buffer {
+    Record records[];
+};
+
+void main()
+{
+    uint i = gl_GlobalInvocationID.x;
+    if (i >= n_particles) return;
+    vec2 pos = particles[i].position;
+    records[i] = Record(pos, morton_code(cell_of(pos)), i);
+}
@@ -0,0 +1,37 @@
+{{ template "version" . }}
+
+layout (local_size_x = {{ .WorkGroupSize }}) in;
+
+uniform uint n_particles;
+// Particles are copied to the order of the records, or back to the order of the particle indices when set.
+uniform uint restore;
+
+{{ template "particle_type" . }}
+{{ template "record_type" . }}
+
+layout(std430, binding = 1) buffer particle_buffer {
+    Particle particles[];
+};
+
+layout(std430, binding = 2) buffer record_buffer {
+    Record records[];
+};
+
+layout(std430, binding = 3) buffer sorted_buffer {
+    Particle sorted[];
+};
+
+void main()
+{
+    uint i = gl_GlobalInvocationID.x;
+    if (i >= n_particles) return;
+    uint index = records[i].index;
+    if (restore != 0u)
+    {
+        particles[index] = sorted[i];
+    }
+    else
+    {
+        sorted[i] = particles[index];
+    }
+}
@@ -0,0 +1,186 @@
+{{ define "kernels" }}
+// 2D kernels of package simulation/kernel. Kernels and their derivatives are zero at distances r >= h. Normalization
+// coefficient c is calculated once by kernel.New, see kernel.Coefficient.
+
+float poly6_w(float r, float c)
+{
+    if (r >= h) return 0.0;
+    float diff = h * h - r * r;
+    return c * diff * diff * diff;
+}
+
+float poly6_gradient(float r, float c)
+{
+    if (r >= h) return 0.0;
+    float diff = h * h - r * r;
+    return -6.0 * c * r * diff * diff;
+}
+
+float poly6_laplacian(float r, float c)
+{
+    if (r >= h) return 0.0;
+    float diff = h * h - r * r;
+    return -6.0 * c * diff * (2.0 * h * h - 6.0 * r * r);
+}
+
+float spiky_w(float r, float c)
+{
+    if (r >= h) return 0.0;
+    float diff = h - r;
+    return c * diff * diff * diff;
+}
+
+float spiky_gradient(float r, float c)
+{
+    if (r >= h) return 0.0;
+    float diff = h - r;
+    return -3.0 * c * diff * diff;
+}
+
+// Laplacian is singular at r = 0, where 0 is returned.
+float spiky_laplacian(float r, float c)
+{
+    if (r >= h || r == 0.0) return 0.0;
+    float diff = h - r;
+    return 6.0 * c * diff - 3.0 * c * diff * diff / r;
+}
+
+// Viscosity kernel is singular at r = 0, so W and its gradient are evaluated at distances of at least h/1000.
+float viscosity_w(float r, float c)
+{
+    if (r >= h) return 0.0;
+    r = max(r, h * 1e-3);
+    return c * (h * r * r / 4.0 - r * r * r / 9.0 - h * h * h / 6.0 * log(r / h) - 5.0 * h * h * h / 36.0);
+}
+
+float viscosity_gradient(float r, float c)
+{
+    if (r >= h) return 0.0;
+    r = max(r, h * 1e-3);
+    return c * (h * r / 2.0 - r * r / 3.0 - h * h * h / (6.0 * r));
+}
+
+float viscosity_laplacian(float r, float c)
+{
+    if (r >= h) return 0.0;
+    return c * (h - r);
+}
+
+float cubic_spline_w(float r, float sigma)
+{
+    float q = r / h;
+    if (q >= 1.0) return 0.0;
+    if (q <= 0.5) return sigma * (6.0 * (q * q * q - q * q) + 1.0);
+    float diff = 1.0 - q;
+    return sigma * 2.0 * diff * diff * diff;
+}
+
+float cubic_spline_gradient(float r, float sigma)
+{
+    float q = r / h;
+    if (q >= 1.0) return 0.0;
+    if (q <= 0.5) return sigma / h * (18.0 * q * q - 12.0 * q);
+    float diff = 1.0 - q;
+    return -6.0 * sigma / h * diff * diff;
+}
+
+float cubic_spline_laplacian(float r, float sigma)
+{
+    float q = r / h;
+    if (q >= 1.0) return 0.0;
+    if (q <= 0.5) return sigma / (h * h) * ((36.0 * q - 12.0) + (18.0 * q - 12.0));
+    float diff = 1.0 - q;
+    return sigma / (h * h) * (12.0 * diff - 6.0 * diff * diff / q);
+}
+
+float wendland_c2_w(float r, float sigma)
+{
+    float q = r / h;
+    if (q >= 1.0) return 0.0;
+    float diff = 1.0 - q;
+    return sigma * diff * diff * diff * diff * (1.0 + 4.0 * q);
+}
+
+float wendland_c2_gradient(float r, float sigma)
+{
+    float q = r / h;
+    if (q >= 1.0) return 0.0;
+    float diff = 1.0 - q;
+    return -20.0 * sigma / h * q * diff * diff * diff;
+}
+
+float wendland_c2_laplacian(float r, float sigma)
+{
+    float q = r / h;
+    if (q >= 1.0) return 0.0;
+    float diff = 1.0 - q;
+    return 20.0 * sigma / (h * h) * diff * diff * ((4.0 * q - 1.0) - diff);
+}
+{{ end }}
+
+{{ define "sph" }}
+#define MAX_NEIGHBOURS {{ .MaxNeighbours }}u
+#define NO_NEIGHBOUR 0xFFFFFFFFu
+
+uniform uint n_particles;
+uniform float mass;
+uniform float h;
+uniform float rest_density;
+uniform vec2 gravity;
+uniform float dt;
+// Normalization coefficients of the density, pressure and viscosity kernels.
+uniform float density_coeff;
+uniform float pressure_coeff;
+uniform float viscosity_coeff;
+
+uniform float stiffness;
+uniform float exponent;
+uniform uint clamp_negative;
+
+uniform float viscosity;
+uniform float alpha;
+uniform float beta;
+uniform float sound_speed;
+uniform float epsilon;
+
+{{ template "kernels" . }}
+
+#define DENSITY_W(r) {{ .DensityKernel }}_w(r, density_coeff)
+#define PRESSURE_GRADIENT(r) {{ .PressureKernel }}_gradient(r, pressure_coeff)
+#define VISCOSITY_LAPLACIAN(r) {{ .ViscosityKernel }}_laplacian(r, viscosity_coeff)
+
+float equation_of_state(float density)
+{
+{{- if eq .EquationOfState "tait" }}
+    float p = stiffness * (pow(density / rest_density, exponent) - 1.0);
+{{- else }}
+    float p = stiffness * (density - rest_density);
+{{- end }}
+    return clamp_negative != 0u ? max(p, 0.0) : p;
+}
+
+// Acceleration of particle a caused by particle b at offset r from b to a and distance dist.
+vec2 viscosity_acceleration(Particle a, Particle b, vec2 r, float dist)
+{
+{{- if eq .Viscosity "laplacian" }}
+    return (b.velocity - a.velocity) * (viscosity / a.density * mass / b.density * VISCOSITY_LAPLACIAN(dist));
+{{- else if eq .Viscosity "artificial" }}
+    float vr = dot(a.velocity - b.velocity, r);
+    if (vr >= 0.0 || dist == 0.0) return vec2(0.0);
+    // Small term in the denominator keeps mu finite for nearly coincident particles.
+    float mu = h * vr / (dist * dist + 0.01 * h * h);
+    float density = (a.density + b.density) / 2.0;
+    float pi = (-alpha * sound_speed * mu + beta * mu * mu) / density;
+    return r * (PRESSURE_GRADIENT(dist) / dist) * (-mass * pi);
+{{- else }}
+    return vec2(0.0);
+{{- end }}
+}
+
+// XSPH correction to the velocity of particle a caused by particle b at distance dist.
+vec2 velocity_correction(Particle a, Particle b, float dist)
+{
+    float density = (a.density + b.density) / 2.0;
+    return (b.velocity - a.velocity) * (epsilon * mass / density * DENSITY_W(dist));
+}
+{{ end }}
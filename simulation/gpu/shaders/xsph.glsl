@@ -0,0 +1,36 @@
+{{ template "version" . }}
+
+layout (local_size_x = {{ .WorkGroupSize }}) in;
+
+{{ template "particle_type" . }}
+{{ template "sph" . }}
+
+layout(std430, binding = 1) buffer particle_buffer {
+    Particle particles[];
+};
+
+layout(std430, binding = 2) buffer neighbour_buffer {
+    uint neighbours[];
+};
+
+// Velocity corrections are stored to the acceleration buffer, which is no longer needed.
+layout(std430, binding = 3) buffer acceleration_buffer {
+    vec2 corrections[];
+};
+
+void main()
+{
+    uint i = gl_GlobalInvocationID.x;
+    if (i >= n_particles) return;
+    Particle pi = particles[i];
+    vec2 correction = vec2(0.0);
+    for (uint k = 0u; k < MAX_NEIGHBOURS; k++)
+    {
+        uint j = neighbours[i * MAX_NEIGHBOURS + k];
+        if (j == NO_NEIGHBOUR) break;
+        if (j == i) continue;
+        Particle pj = particles[j];
+        correction += velocity_correction(pi, pj, length(pi.position - pj.position));
+    }
+    corrections[i] = correction;
+}
@@ -0,0 +1,314 @@
+package gpu
+
+import (
+	"fmt"
+	"unsafe"
+
+	gl "github.com/go-gl/gl/v4.3-core/gl"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+
+	"github.com/MatiasLyyra/fluid/simulation"
+	"github.com/MatiasLyyra/fluid/simulation/kernel"
+)
+
+// kernelFunctions maps kernel types to the prefixes of their GLSL functions.
+var kernelFunctions = map[kernel.Type]string{
+	kernel.Poly6:       "poly6",
+	kernel.Spiky:       "spiky",
+	kernel.Viscosity:   "viscosity",
+	kernel.CubicSpline: "cubic_spline",
+	kernel.WendlandC2:  "wendland_c2",
+}
+
+// sphUniforms holds uniform locations of the sph template shared by the solver shaders. Uniforms not used by a shader
+// have location -1, for which setting the value is ignored.
+type sphUniforms struct {
+	particles     int32
+	mass          int32
+	h             int32
+	restDensity   int32
+	gravity       int32
+	dt            int32
+	kernelCoeffs  [3]int32
+	stiffness     int32
+	exponent      int32
+	clampNegative int32
+	viscosity     int32
+	alpha         int32
+	beta          int32
+	soundSpeed    int32
+	epsilon       int32
+}
+
+func getSPHUniforms(shaderProg uint32) sphUniforms {
+	return sphUniforms{
+		particles:   rl.GetLocationUniform(shaderProg, "n_particles"),
+		mass:        rl.GetLocationUniform(shaderProg, "mass"),
+		h:           rl.GetLocationUniform(shaderProg, "h"),
+		restDensity: rl.GetLocationUniform(shaderProg, "rest_density"),
+		gravity:     rl.GetLocationUniform(shaderProg, "gravity"),
+		dt:          rl.GetLocationUniform(shaderProg, "dt"),
+		kernelCoeffs: [3]int32{
+			rl.GetLocationUniform(shaderProg, "density_coeff"),
+			rl.GetLocationUniform(shaderProg, "pressure_coeff"),
+			rl.GetLocationUniform(shaderProg, "viscosity_coeff"),
+		},
+		stiffness:     rl.GetLocationUniform(shaderProg, "stiffness"),
+		exponent:      rl.GetLocationUniform(shaderProg, "exponent"),
+		clampNegative: rl.GetLocationUniform(shaderProg, "clamp_negative"),
+		viscosity:     rl.GetLocationUniform(shaderProg, "viscosity"),
+		alpha:         rl.GetLocationUniform(shaderProg, "alpha"),
+		beta:          rl.GetLocationUniform(shaderProg, "beta"),
+		soundSpeed:    rl.GetLocationUniform(shaderProg, "sound_speed"),
+		epsilon:       rl.GetLocationUniform(shaderProg, "epsilon"),
+	}
+}
+
+func (locs sphUniforms) set(params simulation.Parameters, n uint32, dt float32) {
+	setFloat := func(loc int32, v float32) {
+		rl.SetUniform(loc, []float32{v}, int32(rl.ShaderUniformFloat))
+	}
+	rl.SetUniform(locs.particles, uniformValues(n), int32(rl.ShaderUniformUint))
+	setFloat(locs.mass, params.ParticleMass)
+	setFloat(locs.h, params.SmoothingRadius)
+	setFloat(locs.restDensity, params.RestDensity)
+	rl.SetUniform(locs.gravity, []float32{params.Gravity.X, params.Gravity.Y}, int32(rl.ShaderUniformVec2))
+	setFloat(locs.dt, dt)
+	h := params.SmoothingRadius
+	for i, t := range []kernel.Type{params.DensityKernel, params.PressureKernel, params.ViscosityKernel} {
+		setFloat(locs.kernelCoeffs[i], kernel.Coefficient(kernel.New(t, h, kernel.Dim2)))
+	}
+
+	var clampNegative uint32
+	switch eos := params.EquationOfState.(type) {
+	case simulation.LinearEOS:
+		setFloat(locs.stiffness, eos.Stiffness)
+		if eos.ClampNegative {
+			clampNegative = 1
+		}
+	case simulation.TaitEOS:
+		setFloat(locs.stiffness, eos.Stiffness)
+		setFloat(locs.exponent, eos.Exponent)
+		if eos.ClampNegative {
+			clampNegative = 1
+		}
+	}
+	rl.SetUniform(locs.clampNegative, uniformValues(clampNegative), int32(rl.ShaderUniformUint))
+
+	switch v := params.Viscosity.(type) {
+	case simulation.LaplacianViscosity:
+		setFloat(locs.viscosity, v.Viscosity)
+	case simulation.ArtificialViscosity:
+		setFloat(locs.alpha, v.Alpha)
+		setFloat(locs.beta, v.Beta)
+		setFloat(locs.soundSpeed, v.SoundSpeed)
+	case simulation.XSPH:
+		setFloat(locs.epsilon, v.Epsilon)
+	}
+}
+
+// sphShaderSettings returns the shader settings selecting the GLSL code for params. Panics if params use a solver other
+// than WCSPH, walls, or kernels, equations of state or viscosity models without a GLSL implementation.
+func sphShaderSettings(params simulation.Parameters) shaderSettings {
+	switch params.Solver.(type) {
+	case nil, simulation.WCSPH:
+	default:
+		panic(fmt.Sprintf("solver %T is not supported on the GPU", params.Solver))
+	}
+	if params.Walls != nil {
+		panic("walls are not supported on the GPU")
+	}
+	settings := defaultShaderSettings()
+	kernelFunction := func(t kernel.Type) string {
+		name, ok := kernelFunctions[t]
+		if !ok {
+			panic(fmt.Sprintf("kernel %v is not supported on the GPU", t))
+		}
+		return name
+	}
+	settings.DensityKernel = kernelFunction(params.DensityKernel)
+	settings.PressureKernel = kernelFunction(params.PressureKernel)
+	settings.ViscosityKernel = kernelFunction(params.ViscosityKernel)
+
+	switch params.EquationOfState.(type) {
+	case simulation.LinearEOS:
+		settings.EquationOfState = "linear"
+	case simulation.TaitEOS:
+		settings.EquationOfState = "tait"
+	default:
+		panic(fmt.Sprintf("equation of state %T is not supported on the GPU", params.EquationOfState))
+	}
+
+	switch params.Viscosity.(type) {
+	case nil:
+		settings.Viscosity = "none"
+	case simulation.LaplacianViscosity:
+		settings.Viscosity = "laplacian"
+	case simulation.ArtificialViscosity:
+		settings.Viscosity = "artificial"
+	case simulation.XSPH:
+		settings.Viscosity = "xsph"
+	default:
+		panic(fmt.Sprintf("viscosity model %T is not supported on the GPU", params.Viscosity))
+	}
+	return settings
+}
+
+// sphProgram is a solver shader program with its uniform locations.
+type sphProgram struct {
+	program  uint32
+	uniforms sphUniforms
+}
+
+func loadSPHProgram(name string, settings shaderSettings) sphProgram {
+	prog := loadShader(name, settings)
+	return sphProgram{program: prog, uniforms: getSPHUniforms(prog)}
+}
+
+// Solver steps the particles of a shader storage buffer with the same weakly compressible SPH as simulation.World,
+// without reading the particles back to the CPU.
+//
+// Particles are copied in the order of the records sorted by the neighbour search at the start of each step, so that
+// the particles of each cell are next to each other in memory, and copied back to the order of the particle indices at
+// the end of the step.
+//
+// Kernels, equation of state and viscosity model are compiled into the shaders, so they are fixed when the solver is
+// created. Other parameters are read from Parameters on each step, and the neighbour search is recreated when the domain
+// or the smoothing radius changes. Walls and boundary particles are not supported.
+type Solver struct {
+	// Parameters of the fluid. Kernels, EquationOfState and Viscosity must have the same types as when the solver was
+	// created.
+	Parameters simulation.Parameters
+
+	search             *NeighbourSearch
+	density            sphProgram
+	acceleration       sphProgram
+	integrate          sphProgram
+	xsph               sphProgram
+	advect             sphProgram
+	reorder            uint32
+	reorderUniforms    reorderUniforms
+	sortedBuffer       uint32
+	accelerationBuffer uint32
+	capacity           uint32
+}
+
+// NewSolver creates solver for at most capacity particles with params.
+func NewSolver(capacity int, params simulation.Parameters) *Solver {
+	settings := sphShaderSettings(params)
+	reorderProg := loadShader("shaders/reorder.glsl", settings)
+	s := &Solver{
+		Parameters:         params,
+		search:             NewNeighbourSearch(capacity, params.DomainMin, params.DomainMax, params.SmoothingRadius),
+		density:            loadSPHProgram("shaders/density.glsl", settings),
+		acceleration:       loadSPHProgram("shaders/acceleration.glsl", settings),
+		integrate:          loadSPHProgram("shaders/integrate.glsl", settings),
+		reorder:            reorderProg,
+		reorderUniforms:    getReorderUniforms(reorderProg),
+		sortedBuffer:       rl.LoadShaderBuffer(uint32(capacity)*uint32(unsafe.Sizeof(simulation.Particle{})), nil, rl.DynamicCopy),
+		accelerationBuffer: rl.LoadShaderBuffer(uint32(capacity)*8, nil, rl.DynamicCopy),
+		capacity:           uint32(capacity),
+	}
+	if settings.Viscosity == "xsph" {
+		s.xsph = loadSPHProgram("shaders/xsph.glsl", settings)
+		s.advect = loadSPHProgram("shaders/advect.glsl", settings)
+	}
+	return s
+}
+
+// Step advances the first count particles of particleBuffer by dt seconds.
+func (s *Solver) Step(particleBuffer uint32, count int, dt float32) {
+	if uint32(count) > s.capacity {
+		panic("count exceeds the capacity of Solver")
+	}
+	if count == 0 {
+		return
+	}
+	n := uint32(count)
+	s.findNeighbours(particleBuffer, count)
+	// Records of each cell are in the order of the particle indices, so the neighbours are summed in the same order as
+	// on the CPU.
+	s.reorderParticles(particleBuffer, n, false)
+	s.dispatch(s.density, n, dt)
+	s.dispatch(s.acceleration, n, dt)
+	s.dispatch(s.integrate, n, dt)
+	if s.xsph.program != 0 {
+		s.dispatch(s.xsph, n, dt)
+		s.dispatch(s.advect, n, dt)
+	}
+	s.reorderParticles(particleBuffer, n, true)
+}
+
+// findNeighbours finds the neighbours of the particles, recreating the search if the domain or the smoothing radius
+// has changed since it was created.
+func (s *Solver) findNeighbours(particleBuffer uint32, count int) {
+	p := s.Parameters
+	if s.search.low != p.DomainMin || s.search.high != p.DomainMax || s.search.radius != p.SmoothingRadius {
+		s.search.Free()
+		s.search = NewNeighbourSearch(int(s.capacity), p.DomainMin, p.DomainMax, p.SmoothingRadius)
+	}
+	s.search.FindSorted(particleBuffer, count)
+}
+
+// reorderUniforms holds uniform locations of the reorder shader.
+type reorderUniforms struct {
+	particles int32
+	restore   int32
+}
+
+func getReorderUniforms(shaderProg uint32) reorderUniforms {
+	return reorderUniforms{
+		particles: rl.GetLocationUniform(shaderProg, "n_particles"),
+		restore:   rl.GetLocationUniform(shaderProg, "restore"),
+	}
+}
+
+// reorderParticles copies the particles of particleBuffer to the sorted buffer in the order of the sorted records, or
+// back when restore is set.
+func (s *Solver) reorderParticles(particleBuffer uint32, n uint32, restore bool) {
+	var restoreValue uint32
+	if restore {
+		restoreValue = 1
+	}
+	rl.EnableShader(s.reorder)
+	rl.SetUniform(s.reorderUniforms.particles, uniformValues(n), int32(rl.ShaderUniformUint))
+	rl.SetUniform(s.reorderUniforms.restore, uniformValues(restoreValue), int32(rl.ShaderUniformUint))
+	rl.BindShaderBuffer(particleBuffer, 1)
+	rl.BindShaderBuffer(s.search.RecordBuffer(), 2)
+	rl.BindShaderBuffer(s.sortedBuffer, 3)
+	rl.ComputeShaderDispatch(workGroups(n), 1, 1)
+	rl.DisableShader()
+	gl.MemoryBarrier(gl.SHADER_STORAGE_BARRIER_BIT)
+}
+
+func (s *Solver) dispatch(prog sphProgram, n uint32, dt float32) {
+	rl.EnableShader(prog.program)
+	prog.uniforms.set(s.Parameters, n, dt)
+	rl.BindShaderBuffer(s.sortedBuffer, 1)
+	rl.BindShaderBuffer(s.search.NeighbourBuffer(), 2)
+	rl.BindShaderBuffer(s.accelerationBuffer, 3)
+	rl.ComputeShaderDispatch(workGroups(n), 1, 1)
+	rl.DisableShader()
+	gl.MemoryBarrier(gl.SHADER_STORAGE_BARRIER_BIT)
+}
+
+// Search returns the neighbour search run at the start of each step. Its neighbours are positions of the sorted records,
+// see NeighbourSearch.FindSorted.
+func (s *Solver) Search() *NeighbourSearch {
+	return s.search
+}
+
+func (s *Solver) Free() {
+	s.search.Free()
+	rl.UnloadShaderProgram(s.density.program)
+	rl.UnloadShaderProgram(s.acceleration.program)
+	rl.UnloadShaderProgram(s.integrate.program)
+	if s.xsph.program != 0 {
+		rl.UnloadShaderProgram(s.xsph.program)
+		rl.UnloadShaderProgram(s.advect.program)
+	}
+	rl.UnloadShaderProgram(s.reorder)
+	rl.UnloadShaderBuffer(s.sortedBuffer)
+	rl.UnloadShaderBuffer(s.accelerationBuffer)
+}
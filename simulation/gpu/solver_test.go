@@ -0,0 +1,145 @@
+//go:build opengl43
+
+package gpu_test
+
+import (
+	"math"
+	"math/rand"
+	"runtime"
+	"slices"
+	"testing"
+	"unsafe"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/MatiasLyyra/fluid/simulation"
+	"github.com/MatiasLyyra/fluid/simulation/gpu"
+	"github.com/MatiasLyyra/fluid/simulation/kernel"
+)
+
+func readParticles(buf uint32, count int) []simulation.Particle {
+	particles := make([]simulation.Particle, count)
+	var p runtime.Pinner
+	p.Pin(unsafe.SliceData(particles))
+	defer p.Unpin()
+	size := uint32(count) * uint32(unsafe.Sizeof(simulation.Particle{}))
+	rl.ReadShaderBuffer(buf, unsafe.Pointer(unsafe.SliceData(particles)), size, 0)
+	return particles
+}
+
+// blockParticles returns jittered block of fluid moving in random directions.
+func blockParticles(r *rand.Rand, params simulation.Parameters, side int) []simulation.Particle {
+	spacing := params.ParticleSpacing()
+	particles := make([]simulation.Particle, side*side)
+	for i := range particles {
+		particles[i] = simulation.Particle{
+			Position: simulation.Vector2{
+				X: 0.3 + spacing*(float32(i%side)+0.2*r.Float32()),
+				Y: 0.3 + spacing*(float32(i/side)+0.2*r.Float32()),
+			},
+			Velocity: simulation.Vector2{X: r.Float32() - 0.5, Y: r.Float32() - 0.5},
+		}
+	}
+	return particles
+}
+
+func TestSolverMatchesCPU(t *testing.T) {
+	tests := map[string]func(*simulation.Parameters){
+		"default": func(*simulation.Parameters) {},
+		"Tait with artificial viscosity": func(p *simulation.Parameters) {
+			c := simulation.SoundSpeed(2)
+			p.EquationOfState = simulation.TaitEOS{Stiffness: simulation.TaitStiffness(c, p.RestDensity, 7), Exponent: 7}
+			p.Viscosity = simulation.ArtificialViscosity{Alpha: 0.05, SoundSpeed: c}
+		},
+		"XSPH with Wendland kernels": func(p *simulation.Parameters) {
+			p.EquationOfState = simulation.LinearEOS{Stiffness: 1000, ClampNegative: true}
+			p.Viscosity = simulation.XSPH{Epsilon: 0.1}
+			p.DensityKernel = kernel.WendlandC2
+			p.PressureKernel = kernel.WendlandC2
+		},
+		"inviscid with cubic spline": func(p *simulation.Parameters) {
+			p.Viscosity = nil
+			p.DensityKernel = kernel.CubicSpline
+			p.PressureKernel = kernel.CubicSpline
+		},
+	}
+	for name, configure := range tests {
+		t.Run(name, func(t *testing.T) {
+			// Subtests run on their own goroutines, so the context is created on the thread of each subtest.
+			initialize(t)
+			params := simulation.DefaultParameters()
+			configure(&params)
+			r := rand.New(rand.NewSource(0))
+			particles := blockParticles(r, params, 64)
+
+			world := simulation.NewWorld(params, slices.Clone(particles))
+			buf := loadParticles(particles)
+			defer rl.UnloadShaderBuffer(buf)
+			solver := gpu.NewSolver(len(particles), params)
+			defer solver.Free()
+
+			const dt = 1e-4
+			for range 10 {
+				world.Step(dt)
+				solver.Step(buf, len(particles), dt)
+			}
+
+			particlesEqual(t, world.Particles, readParticles(buf, len(particles)))
+		})
+	}
+}
+
+func TestSolverFollowsSmoothingRadius(t *testing.T) {
+	initialize(t)
+	params := simulation.DefaultParameters()
+	r := rand.New(rand.NewSource(0))
+	particles := blockParticles(r, params, 32)
+
+	world := simulation.NewWorld(params, slices.Clone(particles))
+	buf := loadParticles(particles)
+	defer rl.UnloadShaderBuffer(buf)
+	solver := gpu.NewSolver(len(particles), params)
+	defer solver.Free()
+
+	const dt = 1e-4
+	world.Step(dt)
+	solver.Step(buf, len(particles), dt)
+	world.Parameters.SmoothingRadius *= 1.5
+	solver.Parameters.SmoothingRadius *= 1.5
+	for range 5 {
+		world.Step(dt)
+		solver.Step(buf, len(particles), dt)
+	}
+
+	particlesEqual(t, world.Particles, readParticles(buf, len(particles)))
+}
+
+func particlesEqual(t *testing.T, expected, actual []simulation.Particle) {
+	for i, e := range expected {
+		a := actual[i]
+		// Pressures of stiff equations of state amplify the rounding differences of the densities, which grow with each
+		// step, so velocities are compared relative to their magnitude.
+		velocityDelta := 1e-3 * (1 + math.Hypot(float64(e.Velocity.X), float64(e.Velocity.Y)))
+		assert.InDelta(t, e.Position.X, a.Position.X, 1e-6, "position of particle %d", i)
+		assert.InDelta(t, e.Position.Y, a.Position.Y, 1e-6, "position of particle %d", i)
+		assert.InDelta(t, e.Velocity.X, a.Velocity.X, velocityDelta, "velocity of particle %d", i)
+		assert.InDelta(t, e.Velocity.Y, a.Velocity.Y, velocityDelta, "velocity of particle %d", i)
+		assert.InEpsilon(t, e.Density, a.Density, 1e-4, "density of particle %d", i)
+	}
+}
+
+func TestSolverRejectsUnsupportedModels(t *testing.T) {
+	initialize(t)
+	params := simulation.DefaultParameters()
+	params.EquationOfState = customEOS{}
+	assert.Panics(t, func() { gpu.NewSolver(16, params) })
+
+	params = simulation.DefaultParameters()
+	params.Walls = &simulation.Walls{}
+	assert.Panics(t, func() { gpu.NewSolver(16, params) })
+}
+
+type customEOS struct{}
+
+func (customEOS) Pressure(density, restDensity float32) float32 { return 0 }
@@ -0,0 +1,205 @@
+package simulation
+
+// IISPH is the implicit incompressible SPH solver of Ihmsen et al. (2014). Pressures are solved from the pressure
+// Poisson equation with relaxed Jacobi iterations until the predicted density error is below Tolerance, which keeps the
+// fluid nearly incompressible with much larger time steps than a stiff equation of state.
+//
+// Density changes are predicted with the gradient of the pressure kernel, so the density and pressure kernels should be
+// the same kernel, such as CubicSpline or WendlandC2, for the density error of the solver to match the density of the
+// particles. EquationOfState of Parameters is not used.
+//
+// References:
+//
+//  1. Ihmsen, Cornelis, Solenthaler, Horvath & Teschner. (2014). Implicit incompressible SPH. IEEE TVCG 20(3). 426-435.
+type IISPH struct {
+	// Tolerance is the average relative density error ρ/ρ0 - 1 of the compressed particles at which iterations stop,
+	// e.g. 0.001 for 0.1%.
+	Tolerance float32
+	// MaxIterations caps the iterations per step. Steps reaching the cap are reported as not converged.
+	MaxIterations int
+	// Omega is the relaxation factor of the Jacobi iterations.
+	Omega float32
+}
+
+// DefaultIISPH returns IISPH with 0.1% density error tolerance.
+func DefaultIISPH() IISPH {
+	return IISPH{
+		Tolerance:     0.001,
+		MaxIterations: 100,
+		Omega:         0.5,
+	}
+}
+
+// minIterations is the minimum count of iterations per step, as the error of the first iteration is calculated from
+// the warm started pressures of the previous step.
+const minIterations = 2
+
+// ConvergenceStats describes the pressure solve of a single step of an iterative solver.
+type ConvergenceStats struct {
+	Iterations int
+	// DensityError is the average relative density error of the compressed particles predicted by the last iteration.
+	DensityError float32
+	// Converged is false when the iterations were stopped by the iteration cap before reaching the tolerance.
+	Converged bool
+}
+
+// iisphBuffers are the per-particle terms of the IISPH pressure solve.
+type iisphBuffers struct {
+	// Displacement of particle i due to its own pressure, dii, and due to the pressures of its neighbours, Σ dij pj.
+	dii, sumDijPj []Vector2
+	// Diagonal element aii of the system and density predicted from the non-pressure forces.
+	aii, densityAdv []float32
+	pressure        []float32
+}
+
+func (s IISPH) step(w *World, dt float32, k Kernels) {
+	n := len(w.Particles)
+	b := &w.iisph
+	b.dii = resize(b.dii, n)
+	b.sumDijPj = resize(b.sumDijPj, n)
+	b.aii = resize(b.aii, n)
+	b.densityAdv = resize(b.densityAdv, n)
+	b.pressure = resize(b.pressure, n)
+
+	w.findNeighbours()
+	w.computeDensity(k.Density)
+	// Velocities are advected with the viscosity and gravity before solving the pressures.
+	for i := range w.acceleration {
+		w.acceleration[i] = Vector2{}
+	}
+	w.addNonPressureAcceleration(k)
+	for i := range w.Particles {
+		p := &w.Particles[i]
+		p.Velocity = p.Velocity.Add(w.acceleration[i].Scale(dt))
+	}
+	s.predictAdvection(w, k, dt)
+	w.convergence = s.solvePressure(w, k, dt)
+
+	// Pressure accelerations are calculated with the same symmetric formula as WCSPH.
+	w.computePressureAcceleration(k)
+	for i := range w.Particles {
+		p := &w.Particles[i]
+		p.Velocity = p.Velocity.Add(w.acceleration[i].Scale(dt))
+		p.Position = p.Position.Add(p.Velocity.Scale(dt))
+	}
+}
+
+// predictAdvection calculates dii, aii and the density after the advection of the particles.
+func (s IISPH) predictAdvection(w *World, k Kernels, dt float32) {
+	mass := w.Parameters.ParticleMass
+	b := &w.iisph
+	for i := range w.Particles {
+		pi := &w.Particles[i]
+		var dii Vector2
+		densityAdv := pi.Density
+		w.forEachNeighbour(i, func(j int, r Vector2, dist float32) {
+			if j == i || dist == 0 {
+				return
+			}
+			gradient := r.Scale(k.Pressure.Gradient(dist) / dist)
+			dii = dii.Subtract(gradient.Scale(mass / (pi.Density * pi.Density)))
+			densityAdv += dt * mass * pi.Velocity.Subtract(w.Particles[j].Velocity).DotProduct(gradient)
+		})
+		// Boundary particles push particle i with its own pressure and do not move.
+		w.forEachBoundaryNeighbour(i, func(bi int, r Vector2, dist float32) {
+			if dist == 0 {
+				return
+			}
+			gradient := r.Scale(k.Pressure.Gradient(dist) / dist)
+			dii = dii.Subtract(gradient.Scale(w.boundaryMass[bi] / (pi.Density * pi.Density)))
+			densityAdv += dt * w.boundaryMass[bi] * pi.Velocity.DotProduct(gradient)
+		})
+		b.dii[i] = dii.Scale(dt * dt)
+		b.densityAdv[i] = densityAdv
+		// Pressures of the previous step are a good initial guess.
+		pi.Pressure *= 0.5
+	}
+	for i := range w.Particles {
+		pi := &w.Particles[i]
+		var aii float32
+		w.forEachNeighbour(i, func(j int, r Vector2, dist float32) {
+			if j == i || dist == 0 {
+				return
+			}
+			gradient := r.Scale(k.Pressure.Gradient(dist) / dist)
+			dji := gradient.Scale(dt * dt * mass / (pi.Density * pi.Density))
+			aii += mass * b.dii[i].Subtract(dji).DotProduct(gradient)
+		})
+		w.forEachBoundaryNeighbour(i, func(bi int, r Vector2, dist float32) {
+			if dist != 0 {
+				aii += w.boundaryMass[bi] * b.dii[i].DotProduct(r.Scale(k.Pressure.Gradient(dist)/dist))
+			}
+		})
+		b.aii[i] = aii
+	}
+}
+
+// solvePressure iterates the pressures of the particles until the predicted density error is below the tolerance.
+func (s IISPH) solvePressure(w *World, k Kernels, dt float32) ConvergenceStats {
+	mass := w.Parameters.ParticleMass
+	restDensity := w.Parameters.RestDensity
+	b := &w.iisph
+	stats := ConvergenceStats{}
+	for stats.Iterations < s.MaxIterations {
+		for i := range w.Particles {
+			var sum Vector2
+			w.forEachNeighbour(i, func(j int, r Vector2, dist float32) {
+				if j == i || dist == 0 {
+					return
+				}
+				pj := &w.Particles[j]
+				gradient := r.Scale(k.Pressure.Gradient(dist) / dist)
+				sum = sum.Subtract(gradient.Scale(mass / (pj.Density * pj.Density) * pj.Pressure))
+			})
+			b.sumDijPj[i] = sum.Scale(dt * dt)
+		}
+
+		var totalError float32
+		compressed := 0
+		for i := range w.Particles {
+			pi := &w.Particles[i]
+			var sum float32
+			w.forEachNeighbour(i, func(j int, r Vector2, dist float32) {
+				if j == i || dist == 0 {
+					return
+				}
+				pj := &w.Particles[j]
+				gradient := r.Scale(k.Pressure.Gradient(dist) / dist)
+				dji := gradient.Scale(dt * dt * mass / (pi.Density * pi.Density))
+				// Displacement of j due to the pressures of its neighbours other than i.
+				sumDjkPk := b.sumDijPj[j].Subtract(dji.Scale(pi.Pressure))
+				sum += mass * b.sumDijPj[i].Subtract(b.dii[j].Scale(pj.Pressure)).Subtract(sumDjkPk).DotProduct(gradient)
+			})
+			w.forEachBoundaryNeighbour(i, func(bi int, r Vector2, dist float32) {
+				if dist != 0 {
+					sum += w.boundaryMass[bi] * b.sumDijPj[i].DotProduct(r.Scale(k.Pressure.Gradient(dist)/dist))
+				}
+			})
+			// Density predicted with the current pressures.
+			density := b.densityAdv[i] + b.aii[i]*pi.Pressure + sum
+			if density > restDensity {
+				totalError += density/restDensity - 1
+				compressed++
+			}
+			pressure := float32(0)
+			if b.aii[i] != 0 {
+				pressure = (1-s.Omega)*pi.Pressure + s.Omega/b.aii[i]*(restDensity-b.densityAdv[i]-sum)
+			}
+			// Negative pressures would pull the free surface together.
+			b.pressure[i] = max(pressure, 0)
+		}
+		for i := range w.Particles {
+			w.Particles[i].Pressure = b.pressure[i]
+		}
+		stats.Iterations++
+		stats.DensityError = 0
+		if compressed > 0 {
+			stats.DensityError = totalError / float32(compressed)
+		}
+		if stats.Iterations >= minIterations && stats.DensityError <= s.Tolerance {
+			stats.Converged = true
+			break
+		}
+	}
+	return stats
+}
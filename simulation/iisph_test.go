@@ -0,0 +1,88 @@
+package simulation_test
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/MatiasLyyra/fluid/simulation"
+	"github.com/MatiasLyyra/fluid/simulation/kernel"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func iisphParameters() simulation.Parameters {
+	params := simulation.DefaultParameters()
+	params.Gravity = simulation.Vector2{}
+	params.DensityKernel = kernel.CubicSpline
+	params.PressureKernel = kernel.CubicSpline
+	params.Solver = simulation.DefaultIISPH()
+	return params
+}
+
+// compressedBlock returns a block of particles compressed towards its center, so the particles start above rest
+// density.
+func compressedBlock(params simulation.Parameters, side int) []simulation.Particle {
+	particles := gridParticles(params, side)
+	for i := range particles {
+		particles[i].Position = particles[i].Position.Scale(0.9).Add(simulation.Vector2{X: 0.4, Y: 0.4})
+	}
+	return particles
+}
+
+// Block of fluid at rest density with random velocities stays within the tolerance of the rest density.
+func TestIISPHConvergesToTolerance(t *testing.T) {
+	params := iisphParameters()
+	r := rand.New(rand.NewSource(0))
+	particles := gridParticles(params, 20)
+	for i := range particles {
+		particles[i].Position = particles[i].Position.Add(simulation.Vector2{X: 0.4, Y: 0.4})
+		particles[i].Velocity = simulation.Vector2{X: r.Float32() - 0.5, Y: r.Float32() - 0.5}
+	}
+	world := simulation.NewWorld(params, particles)
+	for range 10 {
+		world.Step(2e-3)
+		stats := world.Convergence()
+		require.True(t, stats.Converged, "iterations %d, error %g", stats.Iterations, stats.DensityError)
+		assert.LessOrEqual(t, stats.DensityError, float32(0.001))
+		assert.GreaterOrEqual(t, stats.Iterations, 2)
+	}
+	// Densities are calculated at the start of the step, so they are the densities at the end of the previous step.
+	var densityError float32
+	for _, p := range world.Particles {
+		densityError += max(p.Density/params.RestDensity-1, 0)
+	}
+	assert.Less(t, densityError/float32(len(world.Particles)), float32(0.001))
+}
+
+func TestIISPHIterationCap(t *testing.T) {
+	params := iisphParameters()
+	iisph := simulation.DefaultIISPH()
+	iisph.MaxIterations = 3
+	params.Solver = iisph
+	world := simulation.NewWorld(params, compressedBlock(params, 20))
+	world.Step(2e-3)
+	stats := world.Convergence()
+	assert.Equal(t, 3, stats.Iterations)
+	assert.False(t, stats.Converged)
+	assert.Greater(t, stats.DensityError, float32(0.001))
+}
+
+func TestIISPHFreeFall(t *testing.T) {
+	params := iisphParameters()
+	params.Gravity = simulation.DefaultParameters().Gravity
+	world := simulation.NewWorld(params, []simulation.Particle{{Position: simulation.Vector2{X: 0.5, Y: 0.5}}})
+	for range 100 {
+		world.Step(1e-3)
+	}
+	p := world.Particles[0]
+	assert.InDelta(t, params.Gravity.Y*0.1, p.Velocity.Y, 1e-4)
+	assert.Zero(t, p.Velocity.X)
+	assert.True(t, world.Convergence().Converged)
+}
+
+func TestConvergenceZeroForWCSPH(t *testing.T) {
+	params := simulation.DefaultParameters()
+	world := simulation.NewWorld(params, gridParticles(params, 10))
+	world.Step(1e-4)
+	assert.Zero(t, world.Convergence())
+}
@@ -0,0 +1,372 @@
+// Package kernel provides normalized SPH smoothing kernels in two and three dimensions.
+//
+// All kernels have compact support of radius h and are functions of the distance r between particles. Coefficients
+// depending on h are calculated once when the kernel is created.
+//
+// References:
+//
+//  1. Müller, Charypar & Gross. (2003). Particle-based fluid simulation for interactive applications. SCA '03.
+//  2. Monaghan. (1992). Smoothed particle hydrodynamics. Annu. Rev. Astron. Astrophys. 30. 543-574.
+//  3. Wendland. (1995). Piecewise polynomial, positive definite and compactly supported radial functions of minimal degree.
+//     Adv. Comput. Math. 4. 389-396.
+package kernel
+
+import (
+	"fmt"
+	"math"
+)
+
+// Kernel is a radially symmetric smoothing kernel W(r) with support radius h.
+type Kernel interface {
+	// Radius returns the support radius h. Kernel and its derivatives are zero at distances r >= h.
+	Radius() float32
+	// W returns the value of the kernel at distance r.
+	W(r float32) float32
+	// Gradient returns dW/dr at distance r. Gradient with respect to the position x of a particle at offset x from the
+	// other particle is Gradient(|x|) * x / |x|.
+	Gradient(r float32) float32
+	// Laplacian returns the Laplacian of the kernel at distance r.
+	Laplacian(r float32) float32
+}
+
+// Dimension is the count of spatial dimensions the kernel is normalized for.
+type Dimension int
+
+const (
+	Dim2 Dimension = 2
+	Dim3 Dimension = 3
+)
+
+// Type selects the kernel function.
+type Type int
+
+const (
+	// Poly6 is the density kernel of Müller et al. Its gradient vanishes at the center, so it is not suitable for pressure.
+	Poly6 Type = iota
+	// Spiky is the pressure kernel of Müller et al. with a non-vanishing gradient at the center.
+	Spiky
+	// Viscosity is the kernel of Müller et al. with a positive, linear Laplacian, used for viscosity forces.
+	Viscosity
+	// CubicSpline is the M4 cubic B-spline kernel of Monaghan.
+	CubicSpline
+	// WendlandC2 is the C2 continuous Wendland kernel, which does not suffer from pairing instability.
+	WendlandC2
+)
+
+func (t Type) String() string {
+	switch t {
+	case Poly6:
+		return "poly6"
+	case Spiky:
+		return "spiky"
+	case Viscosity:
+		return "viscosity"
+	case CubicSpline:
+		return "cubic spline"
+	case WendlandC2:
+		return "Wendland C2"
+	default:
+		return fmt.Sprintf("Type(%d)", int(t))
+	}
+}
+
+// New creates kernel of type t with support radius h normalized in dim dimensions.
+func New(t Type, h float32, dim Dimension) Kernel {
+	if dim != Dim2 && dim != Dim3 {
+		panic(fmt.Sprintf("unsupported kernel dimension %d", dim))
+	}
+	if h <= 0 {
+		panic("kernel support radius must be positive")
+	}
+	switch t {
+	case Poly6:
+		return newPoly6(h, dim)
+	case Spiky:
+		return newSpiky(h, dim)
+	case Viscosity:
+		return newViscosity(h, dim)
+	case CubicSpline:
+		return newCubicSpline(h, dim)
+	case WendlandC2:
+		return newWendlandC2(h, dim)
+	default:
+		panic(fmt.Sprintf("unknown kernel type %v", t))
+	}
+}
+
+// Coefficient returns the normalization coefficient of k calculated from h when k was created: A of Poly6, B of Spiky,
+// C of Viscosity, and σ of CubicSpline and WendlandC2. It lets the kernels be evaluated elsewhere, such as in shaders,
+// without recalculating the powers of h.
+func Coefficient(k Kernel) float32 {
+	switch k := k.(type) {
+	case poly6:
+		return k.coeff
+	case spiky:
+		return k.coeff
+	case viscosity:
+		return k.coeff
+	case cubicSpline:
+		return k.sigma
+	case wendlandC2:
+		return k.sigma
+	default:
+		panic(fmt.Sprintf("unknown kernel %T", k))
+	}
+}
+
+// poly6 is W(r) = A (h² - r²)³.
+type poly6 struct {
+	h, hSq float32
+	dim    float32
+	coeff  float32
+}
+
+func newPoly6(h float32, dim Dimension) poly6 {
+	var coeff float64
+	if dim == Dim2 {
+		coeff = 4 / (math.Pi * pow(h, 8))
+	} else {
+		coeff = 315 / (64 * math.Pi * pow(h, 9))
+	}
+	return poly6{h: h, hSq: h * h, dim: float32(dim), coeff: float32(coeff)}
+}
+
+func (k poly6) Radius() float32 { return k.h }
+
+func (k poly6) W(r float32) float32 {
+	if r >= k.h {
+		return 0
+	}
+	diff := k.hSq - r*r
+	return k.coeff * diff * diff * diff
+}
+
+func (k poly6) Gradient(r float32) float32 {
+	if r >= k.h {
+		return 0
+	}
+	diff := k.hSq - r*r
+	return -6 * k.coeff * r * diff * diff
+}
+
+func (k poly6) Laplacian(r float32) float32 {
+	if r >= k.h {
+		return 0
+	}
+	diff := k.hSq - r*r
+	return -6 * k.coeff * diff * (k.dim*k.hSq - (k.dim+4)*r*r)
+}
+
+// spiky is W(r) = B (h - r)³.
+type spiky struct {
+	h     float32
+	dim   float32
+	coeff float32
+}
+
+func newSpiky(h float32, dim Dimension) spiky {
+	var coeff float64
+	if dim == Dim2 {
+		coeff = 10 / (math.Pi * pow(h, 5))
+	} else {
+		coeff = 15 / (math.Pi * pow(h, 6))
+	}
+	return spiky{h: h, dim: float32(dim), coeff: float32(coeff)}
+}
+
+func (k spiky) Radius() float32 { return k.h }
+
+func (k spiky) W(r float32) float32 {
+	if r >= k.h {
+		return 0
+	}
+	diff := k.h - r
+	return k.coeff * diff * diff * diff
+}
+
+func (k spiky) Gradient(r float32) float32 {
+	if r >= k.h {
+		return 0
+	}
+	diff := k.h - r
+	return -3 * k.coeff * diff * diff
+}
+
+// Laplacian is singular at r = 0, where 0 is returned.
+func (k spiky) Laplacian(r float32) float32 {
+	if r >= k.h || r == 0 {
+		return 0
+	}
+	diff := k.h - r
+	return 6*k.coeff*diff - (k.dim-1)*3*k.coeff*diff*diff/r
+}
+
+// viscosity is the kernel of Müller et al. with the Laplacian C (h - r). In 3D it is
+// W(r) = 15/(2πh³) (-q³/2 + q² + 1/2q - 1) with q = r/h, and in 2D the same Laplacian gives
+// W(r) = C (h r²/4 - r³/9 - h³/6 ln(r/h) - 5h³/36) with C = 40/(πh⁵). Both are singular at r = 0, so W and its
+// gradient are evaluated at distances of at least h/1000.
+type viscosity struct {
+	h     float32
+	dim   Dimension
+	coeff float32
+	// Laplacian coefficient C.
+	lapCoeff float32
+}
+
+func newViscosity(h float32, dim Dimension) viscosity {
+	if dim == Dim2 {
+		c := float32(40 / (math.Pi * pow(h, 5)))
+		return viscosity{h: h, dim: dim, coeff: c, lapCoeff: c}
+	}
+	return viscosity{
+		h:        h,
+		dim:      dim,
+		coeff:    float32(15 / (2 * math.Pi * pow(h, 3))),
+		lapCoeff: float32(45 / (math.Pi * pow(h, 6))),
+	}
+}
+
+func (k viscosity) Radius() float32 { return k.h }
+
+func (k viscosity) W(r float32) float32 {
+	if r >= k.h {
+		return 0
+	}
+	r = max(r, k.h*1e-3)
+	h := k.h
+	if k.dim == Dim2 {
+		return k.coeff * (h*r*r/4 - r*r*r/9 - h*h*h/6*float32(math.Log(float64(r/h))) - 5*h*h*h/36)
+	}
+	q := r / h
+	return k.coeff * (-q*q*q/2 + q*q + 1/(2*q) - 1)
+}
+
+func (k viscosity) Gradient(r float32) float32 {
+	if r >= k.h {
+		return 0
+	}
+	r = max(r, k.h*1e-3)
+	h := k.h
+	if k.dim == Dim2 {
+		return k.coeff * (h*r/2 - r*r/3 - h*h*h/(6*r))
+	}
+	q := r / h
+	return k.coeff / h * (-1.5*q*q + 2*q - 1/(2*q*q))
+}
+
+func (k viscosity) Laplacian(r float32) float32 {
+	if r >= k.h {
+		return 0
+	}
+	return k.lapCoeff * (k.h - r)
+}
+
+// cubicSpline is W(q) = σ (6(q³ - q²) + 1) for q <= 1/2 and σ 2(1 - q)³ for 1/2 < q <= 1, where q = r/h.
+type cubicSpline struct {
+	h     float32
+	dim   float32
+	sigma float32
+}
+
+func newCubicSpline(h float32, dim Dimension) cubicSpline {
+	var sigma float64
+	if dim == Dim2 {
+		sigma = 40 / (7 * math.Pi * pow(h, 2))
+	} else {
+		sigma = 8 / (math.Pi * pow(h, 3))
+	}
+	return cubicSpline{h: h, dim: float32(dim), sigma: float32(sigma)}
+}
+
+func (k cubicSpline) Radius() float32 { return k.h }
+
+func (k cubicSpline) W(r float32) float32 {
+	q := r / k.h
+	switch {
+	case q >= 1:
+		return 0
+	case q <= 0.5:
+		return k.sigma * (6*(q*q*q-q*q) + 1)
+	default:
+		diff := 1 - q
+		return k.sigma * 2 * diff * diff * diff
+	}
+}
+
+func (k cubicSpline) Gradient(r float32) float32 {
+	q := r / k.h
+	switch {
+	case q >= 1:
+		return 0
+	case q <= 0.5:
+		return k.sigma / k.h * (18*q*q - 12*q)
+	default:
+		diff := 1 - q
+		return -6 * k.sigma / k.h * diff * diff
+	}
+}
+
+func (k cubicSpline) Laplacian(r float32) float32 {
+	q := r / k.h
+	hSq := k.h * k.h
+	switch {
+	case q >= 1:
+		return 0
+	case q <= 0.5:
+		// Gradient divided by r is 18q - 12, which is finite at the center.
+		return k.sigma / hSq * ((36*q - 12) + (k.dim-1)*(18*q-12))
+	default:
+		diff := 1 - q
+		return k.sigma / hSq * (12*diff - (k.dim-1)*6*diff*diff/q)
+	}
+}
+
+// wendlandC2 is W(q) = σ (1 - q)⁴ (1 + 4q), where q = r/h.
+type wendlandC2 struct {
+	h     float32
+	dim   float32
+	sigma float32
+}
+
+func newWendlandC2(h float32, dim Dimension) wendlandC2 {
+	var sigma float64
+	if dim == Dim2 {
+		sigma = 7 / (math.Pi * pow(h, 2))
+	} else {
+		sigma = 21 / (2 * math.Pi * pow(h, 3))
+	}
+	return wendlandC2{h: h, dim: float32(dim), sigma: float32(sigma)}
+}
+
+func (k wendlandC2) Radius() float32 { return k.h }
+
+func (k wendlandC2) W(r float32) float32 {
+	q := r / k.h
+	if q >= 1 {
+		return 0
+	}
+	diff := 1 - q
+	return k.sigma * diff * diff * diff * diff * (1 + 4*q)
+}
+
+func (k wendlandC2) Gradient(r float32) float32 {
+	q := r / k.h
+	if q >= 1 {
+		return 0
+	}
+	diff := 1 - q
+	return -20 * k.sigma / k.h * q * diff * diff * diff
+}
+
+func (k wendlandC2) Laplacian(r float32) float32 {
+	q := r / k.h
+	if q >= 1 {
+		return 0
+	}
+	diff := 1 - q
+	return 20 * k.sigma / (k.h * k.h) * diff * diff * ((4*q - 1) - (k.dim-1)*diff)
+}
+
+func pow(x float32, n int) float64 {
+	return math.Pow(float64(x), float64(n))
+}
@@ -0,0 +1,93 @@
+package kernel_test
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/MatiasLyyra/fluid/simulation/kernel"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	types      = []kernel.Type{kernel.Poly6, kernel.Spiky, kernel.Viscosity, kernel.CubicSpline, kernel.WendlandC2}
+	dimensions = []kernel.Dimension{kernel.Dim2, kernel.Dim3}
+)
+
+// integrate returns the integral of the kernel over its support with the midpoint rule in spherical shells.
+func integrate(k kernel.Kernel, dim kernel.Dimension) float64 {
+	const steps = 100000
+	h := float64(k.Radius())
+	dr := h / steps
+	var sum float64
+	for i := range steps {
+		r := (float64(i) + 0.5) * dr
+		shell := 2 * math.Pi * r
+		if dim == kernel.Dim3 {
+			shell = 4 * math.Pi * r * r
+		}
+		sum += float64(k.W(float32(r))) * shell * dr
+	}
+	return sum
+}
+
+func TestKernelsIntegrateToOne(t *testing.T) {
+	for _, typ := range types {
+		for _, dim := range dimensions {
+			for _, h := range []float32{0.01, 1} {
+				t.Run(fmt.Sprintf("%v/%dD/h=%v", typ, dim, h), func(t *testing.T) {
+					k := kernel.New(typ, h, dim)
+					assert.InDelta(t, 1, integrate(k, dim), 1e-3)
+				})
+			}
+		}
+	}
+}
+
+func TestKernelDerivatives(t *testing.T) {
+	const h = 0.5
+	const dr = h * 1e-3
+	for _, typ := range types {
+		for _, dim := range dimensions {
+			t.Run(fmt.Sprintf("%v/%dD", typ, dim), func(t *testing.T) {
+				k := kernel.New(typ, h, dim)
+				for _, q := range []float32{0.25, 0.4, 0.55, 0.7, 0.9} {
+					r := q * h
+					gradient := (k.W(r+dr) - k.W(r-dr)) / (2 * dr)
+					assert.InEpsilon(t, gradient, k.Gradient(r), 1e-2, "gradient at q=%v", q)
+
+					secondDerivative := (k.Gradient(r+dr) - k.Gradient(r-dr)) / (2 * dr)
+					laplacian := secondDerivative + float32(dim-1)/r*k.Gradient(r)
+					assert.InDelta(t, laplacian, k.Laplacian(r), 1e-2*math.Abs(float64(laplacian))+1e-3, "laplacian at q=%v", q)
+				}
+				assert.Zero(t, k.W(h))
+				assert.Zero(t, k.Gradient(h))
+				assert.Zero(t, k.Laplacian(h))
+			})
+		}
+	}
+}
+
+func TestKernelPanicsOnInvalidArguments(t *testing.T) {
+	assert.Panics(t, func() { kernel.New(kernel.Poly6, 1, 4) })
+	assert.Panics(t, func() { kernel.New(kernel.Poly6, 0, kernel.Dim2) })
+	assert.Panics(t, func() { kernel.New(kernel.Type(100), 1, kernel.Dim2) })
+}
+
+func TestKernelCoefficient(t *testing.T) {
+	const h = 0.5
+	// Value of W at the center in units of the coefficient in 2D.
+	center := map[kernel.Type]float64{
+		kernel.Poly6:       math.Pow(h, 6),
+		kernel.Spiky:       math.Pow(h, 3),
+		kernel.CubicSpline: 1,
+		kernel.WendlandC2:  1,
+	}
+	for typ, scale := range center {
+		k := kernel.New(typ, h, kernel.Dim2)
+		assert.InEpsilon(t, k.W(0), float64(kernel.Coefficient(k))*scale, 1e-6, "%v", typ)
+	}
+	// Laplacian of the viscosity kernel is C (h - r).
+	k := kernel.New(kernel.Viscosity, h, kernel.Dim2)
+	assert.InEpsilon(t, k.Laplacian(0), kernel.Coefficient(k)*h, 1e-6)
+}
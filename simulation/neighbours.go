@@ -0,0 +1,190 @@
+package simulation
+
+import (
+	"cmp"
+	"math"
+	"slices"
+)
+
+// MaxNeighbours is the count of neighbours stored for each particle, including the particle itself.
+const MaxNeighbours = 32
+
+// NoNeighbour pads the neighbours of particles with less than MaxNeighbours neighbours.
+const NoNeighbour = math.MaxUint32
+
+// NeighbourList has MaxNeighbours particle indices for each particle, padded with NoNeighbour.
+type NeighbourList []uint32
+
+// Neighbours returns the neighbours of particle i without padding.
+func (l NeighbourList) Neighbours(i int) []uint32 {
+	row := l[i*MaxNeighbours : (i+1)*MaxNeighbours]
+	if n := slices.Index(row, NoNeighbour); n >= 0 {
+		return row[:n]
+	}
+	return row
+}
+
+// HashPosition returns the Morton code of the grid cell of size step containing pos. Positions outside the range are
+// clamped to the cells at its border.
+func HashPosition(pos, rangeLow, rangeHigh Vector2, step float32) uint32 {
+	x, y := cellOf(pos, rangeLow, rangeHigh, 1/step)
+	return mortonCode(x, y)
+}
+
+// cellOf returns the grid cell of pos. Position is multiplied by the inverse of the cell size, as division is not
+// correctly rounded on GPUs and the cells must match exactly between the CPU and the GPU.
+func cellOf(pos, rangeLow, rangeHigh Vector2, invStep float32) (uint32, uint32) {
+	pos = pos.Clamp(rangeLow, rangeHigh)
+	return uint32((pos.X - rangeLow.X) * invStep), uint32((pos.Y - rangeLow.Y) * invStep)
+}
+
+// distanceSqr returns the squared distance between a and b. Explicit conversions prevent fusing the operations to
+// fused multiply-add, so the result is identical to the GPU neighbour search.
+func distanceSqr(a, b Vector2) float32 {
+	dx := a.X - b.X
+	dy := a.Y - b.Y
+	return float32(dx*dx) + float32(dy*dy)
+}
+
+func mortonCode(x, y uint32) uint32 {
+	return interleave2d(x) | interleave2d(y)<<1
+}
+
+// interleave2d spreads the lower 16 bits of v to the even bits.
+func interleave2d(v uint32) uint32 {
+	v = (v ^ (v << 8)) & 0x00ff00ff
+	v = (v ^ (v << 4)) & 0x0f0f0f0f
+	v = (v ^ (v << 2)) & 0x33333333
+	return (v ^ (v << 1)) & 0x55555555
+}
+
+// NeighbourSearch finds the particles within the smoothing radius of each particle using a uniform grid of cells of the
+// size of the radius. Particles are sorted by the Morton codes of their cells, so the particles of each cell are
+// consecutive, and the neighbours of a particle are found in the 3×3 cells around it.
+//
+// Cell ranges are stored for every Morton code of the grid, so the memory used grows with the square of the domain size
+// divided by the radius. Particles outside the domain are clamped to the cells at its border, which is correct but
+// slow when many particles leave the domain.
+type NeighbourSearch struct {
+	low, high Vector2
+	radius    float32
+	invRadius float32
+	// Cells along each axis.
+	cellsX, cellsY uint32
+
+	sorted []cellEntry
+	// Range of each cell in sorted, indexed by Morton code. Empty cells have start NoNeighbour.
+	cellStart, cellEnd []uint32
+
+	list     NeighbourList
+	overflow []uint32
+}
+
+type cellEntry struct {
+	Code  uint32
+	Index uint32
+}
+
+// NewNeighbourSearch creates search for particles in the domain from low to high with smoothing radius radius.
+func NewNeighbourSearch(low, high Vector2, radius float32) *NeighbourSearch {
+	if radius <= 0 {
+		panic("neighbour search radius must be positive")
+	}
+	if high.X < low.X || high.Y < low.Y {
+		panic("neighbour search domain is empty")
+	}
+	s := &NeighbourSearch{low: low, high: high, radius: radius, invRadius: 1 / radius}
+	s.cellsX, s.cellsY = cellOf(high, low, high, s.invRadius)
+	s.cellsX++
+	s.cellsY++
+	if s.cellsX > 1<<16 || s.cellsY > 1<<16 {
+		panic("neighbour search domain has too many cells for 32-bit Morton codes")
+	}
+	cells := mortonCode(s.cellsX-1, s.cellsY-1) + 1
+	s.cellStart = make([]uint32, cells)
+	s.cellEnd = make([]uint32, cells)
+	return s
+}
+
+// Find finds the neighbours of particles, including each particle itself. Neighbours are listed in the order of their
+// cells row by row from the bottom left, and by index within each cell. Neighbours past MaxNeighbours are left out and
+// counted as overflow. Returns the total overflow of all particles.
+func (s *NeighbourSearch) Find(particles []Particle) int {
+	s.sort(particles)
+	n := len(particles)
+	s.list = slices.Grow(s.list[:0], n*MaxNeighbours)[:n*MaxNeighbours]
+	s.overflow = slices.Grow(s.overflow[:0], n)[:n]
+	total := 0
+	for i, p := range particles {
+		row := s.list[i*MaxNeighbours : (i+1)*MaxNeighbours]
+		count := 0
+		overflow := uint32(0)
+		s.forEachNear(p.Position, particles, func(j uint32) {
+			if count < MaxNeighbours {
+				row[count] = j
+				count++
+			} else {
+				overflow++
+			}
+		})
+		for j := count; j < MaxNeighbours; j++ {
+			row[j] = NoNeighbour
+		}
+		s.overflow[i] = overflow
+		total += int(overflow)
+	}
+	return total
+}
+
+// sort sorts particles by their cells and finds the range of each cell.
+func (s *NeighbourSearch) sort(particles []Particle) {
+	n := len(particles)
+	s.sorted = slices.Grow(s.sorted[:0], n)[:n]
+	for i, p := range particles {
+		s.sorted[i] = cellEntry{Code: mortonCode(cellOf(p.Position, s.low, s.high, s.invRadius)), Index: uint32(i)}
+	}
+	slices.SortFunc(s.sorted, func(a, b cellEntry) int {
+		return cmp.Or(cmp.Compare(a.Code, b.Code), cmp.Compare(a.Index, b.Index))
+	})
+
+	for i := range s.cellStart {
+		s.cellStart[i] = NoNeighbour
+	}
+	for i, e := range s.sorted {
+		if i == 0 || s.sorted[i-1].Code != e.Code {
+			s.cellStart[e.Code] = uint32(i)
+		}
+		s.cellEnd[e.Code] = uint32(i + 1)
+	}
+}
+
+// forEachNear calls fn with the index of each of particles within the radius of pos in the order of Find. Particles
+// must be the particles last sorted.
+func (s *NeighbourSearch) forEachNear(pos Vector2, particles []Particle, fn func(j uint32)) {
+	radiusSq := s.radius * s.radius
+	cx, cy := cellOf(pos, s.low, s.high, s.invRadius)
+	for y := max(cy, 1) - 1; y <= min(cy+1, s.cellsY-1); y++ {
+		for x := max(cx, 1) - 1; x <= min(cx+1, s.cellsX-1); x++ {
+			code := mortonCode(x, y)
+			start := s.cellStart[code]
+			if start == NoNeighbour {
+				continue
+			}
+			for _, e := range s.sorted[start:s.cellEnd[code]] {
+				if distanceSqr(pos, particles[e.Index].Position) < radiusSq {
+					fn(e.Index)
+				}
+			}
+		}
+	}
+}
+
+// List returns the neighbours found by the last Find.
+func (s *NeighbourSearch) List() NeighbourList {
+	return s.list
+}
+
+// Overflow returns the count of neighbours of particle i left out of the list by the last Find.
+func (s *NeighbourSearch) Overflow(i int) uint32 {
+	return s.overflow[i]
+}
@@ -0,0 +1,85 @@
+package simulation_test
+
+import (
+	"math/rand"
+	"slices"
+	"testing"
+
+	"github.com/MatiasLyyra/fluid/simulation"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func bruteForceNeighbours(particles []simulation.Particle, radius float32) [][]uint32 {
+	neighbours := make([][]uint32, len(particles))
+	for i, pi := range particles {
+		for j, pj := range particles {
+			if pi.Position.DistanceSqr(pj.Position) < radius*radius {
+				neighbours[i] = append(neighbours[i], uint32(j))
+			}
+		}
+	}
+	return neighbours
+}
+
+func randomParticles(r *rand.Rand, n int, low, high simulation.Vector2) []simulation.Particle {
+	particles := make([]simulation.Particle, n)
+	for i := range particles {
+		particles[i].Position = simulation.Vector2{
+			X: low.X + r.Float32()*(high.X-low.X),
+			Y: low.Y + r.Float32()*(high.Y-low.Y),
+		}
+	}
+	return particles
+}
+
+func TestNeighbourSearch(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	low, high := simulation.Vector2{X: 0, Y: 0}, simulation.Vector2{X: 1, Y: 1}
+	const radius = 0.05
+	// Some particles are outside the domain and clamped to its border cells.
+	particles := randomParticles(r, 2000, simulation.Vector2{X: -0.1, Y: -0.1}, simulation.Vector2{X: 1.1, Y: 1.1})
+	search := simulation.NewNeighbourSearch(low, high, radius)
+	require.Zero(t, search.Find(particles))
+
+	expected := bruteForceNeighbours(particles, radius)
+	list := search.List()
+	require.Len(t, list, len(particles)*simulation.MaxNeighbours)
+	for i := range particles {
+		neighbours := slices.Clone(list.Neighbours(i))
+		slices.Sort(neighbours)
+		assert.Equal(t, expected[i], neighbours, "neighbours of particle %d", i)
+		for _, j := range list[i*simulation.MaxNeighbours+len(neighbours) : (i+1)*simulation.MaxNeighbours] {
+			assert.Equal(t, uint32(simulation.NoNeighbour), j)
+		}
+	}
+}
+
+func TestNeighbourSearchOverflow(t *testing.T) {
+	r := rand.New(rand.NewSource(2))
+	const radius = 0.05
+	const count = simulation.MaxNeighbours + 8
+	// Every particle of the cluster is a neighbour of every other.
+	cluster := randomParticles(r, count, simulation.Vector2{X: 0.5, Y: 0.5}, simulation.Vector2{X: 0.51, Y: 0.51})
+	lonely := simulation.Particle{Position: simulation.Vector2{X: 0.1, Y: 0.1}}
+	particles := append(cluster, lonely)
+
+	search := simulation.NewNeighbourSearch(simulation.Vector2{}, simulation.Vector2{X: 1, Y: 1}, radius)
+	assert.Equal(t, count*8, search.Find(particles))
+	for i := range cluster {
+		assert.Len(t, search.List().Neighbours(i), simulation.MaxNeighbours)
+		assert.Equal(t, uint32(8), search.Overflow(i))
+	}
+	assert.Equal(t, []uint32{count}, search.List().Neighbours(count))
+	assert.Zero(t, search.Overflow(count))
+}
+
+func TestHashPosition(t *testing.T) {
+	low, high := simulation.Vector2{}, simulation.Vector2{X: 1, Y: 1}
+	assert.Equal(t, uint32(0), simulation.HashPosition(simulation.Vector2{X: 0.05, Y: 0.05}, low, high, 0.1))
+	assert.Equal(t, uint32(0b01), simulation.HashPosition(simulation.Vector2{X: 0.15, Y: 0.05}, low, high, 0.1))
+	assert.Equal(t, uint32(0b10), simulation.HashPosition(simulation.Vector2{X: 0.05, Y: 0.15}, low, high, 0.1))
+	assert.Equal(t, uint32(0b1101), simulation.HashPosition(simulation.Vector2{X: 0.35, Y: 0.25}, low, high, 0.1))
+	// Outside positions are clamped.
+	assert.Equal(t, uint32(0), simulation.HashPosition(simulation.Vector2{X: -5, Y: -5}, low, high, 0.1))
+}
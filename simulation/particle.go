@@ -2,6 +2,9 @@ package simulation
 
 type Particle struct {
 	Position Vector2
-	// Density  float32
-	// Code     uint32
+	Velocity Vector2
+	// Density estimated from the neighbouring particles.
+	Density float32
+	// Pressure calculated from the density by the equation of state.
+	Pressure float32
 }
@@ -0,0 +1,222 @@
+package simulation
+
+import "math"
+
+// PBF is the Position Based Fluids solver of Macklin & Müller (2013). Instead of calculating pressure from the density,
+// positions are projected to satisfy a constant density constraint, which stays stable with much larger time steps than
+// WCSPH.
+//
+// Density is calculated with the density kernel and constraint gradients with the pressure kernel. EquationOfState and
+// Viscosity of Parameters are not used, as the constraint replaces the pressure and XSPH the viscosity. Pressure of the
+// particles is set to zero.
+type PBF struct {
+	// Iterations of the density constraint projection per step.
+	Iterations int
+	// Relaxation ε of the constraint relative to 1/h², which softens the constraint and keeps λ finite for particles
+	// without neighbours.
+	Relaxation float32
+	// Tensile instability correction s_corr = -CorrectionK (W(r) / W(CorrectionDeltaQ h))^CorrectionN, which pushes
+	// particles apart at the free surface to prevent clumping. s_corr is a constraint violation like ρ/ρ0 - 1, so it is
+	// scaled to λ like the constraint, making it independent of the units of the simulation.
+	CorrectionK      float32
+	CorrectionN      float32
+	CorrectionDeltaQ float32
+	// VorticityConfinement ε restores the rotational motion damped by the projection and XSPH, in units of length per
+	// time.
+	VorticityConfinement float32
+	// XSPH velocity correction applied at the end of each step.
+	XSPH XSPH
+}
+
+// DefaultPBF returns PBF with the tensile instability correction suggested by Macklin & Müller, four iterations and
+// light vorticity confinement and XSPH.
+func DefaultPBF() PBF {
+	return PBF{
+		Iterations:           4,
+		Relaxation:           0.1,
+		CorrectionK:          0.1,
+		CorrectionN:          4,
+		CorrectionDeltaQ:     0.2,
+		VorticityConfinement: 1e-3,
+		XSPH:                 XSPH{Epsilon: 0.01},
+	}
+}
+
+func (s PBF) step(w *World, dt float32, k Kernels) {
+	n := len(w.Particles)
+	w.previous = resize(w.previous, n)
+	w.lambda = resize(w.lambda, n)
+	w.lambdaScale = resize(w.lambdaScale, n)
+	w.vorticity = resize(w.vorticity, n)
+
+	// Predict positions with the external forces.
+	for i := range w.Particles {
+		p := &w.Particles[i]
+		w.previous[i] = p.Position
+		p.Velocity = p.Velocity.Add(w.Parameters.Gravity.Scale(dt))
+		p.Position = p.Position.Add(p.Velocity.Scale(dt))
+	}
+	// Neighbours are found once per step at the predicted positions.
+	w.findNeighbours()
+	for range s.Iterations {
+		s.computeLambda(w, k)
+		s.computeCorrection(w, k)
+		for i := range w.Particles {
+			p := &w.Particles[i]
+			p.Position = p.Position.Add(w.acceleration[i])
+		}
+	}
+
+	if dt > 0 {
+		for i := range w.Particles {
+			p := &w.Particles[i]
+			p.Velocity = p.Position.Subtract(w.previous[i]).Scale(1 / dt)
+		}
+	}
+	w.computeDensity(k.Density)
+	for i := range w.Particles {
+		w.Particles[i].Pressure = 0
+	}
+	s.applyVorticityConfinement(w, k, dt)
+	s.applyXSPH(w, k)
+}
+
+// computeLambda calculates the scaling factor λ of the density constraint C = ρ/ρ0 - 1 of each particle.
+func (s PBF) computeLambda(w *World, k Kernels) {
+	mass := w.Parameters.ParticleMass
+	restDensity := w.Parameters.RestDensity
+	h := w.Parameters.SmoothingRadius
+	relaxation := s.Relaxation / (h * h)
+	for i := range w.Particles {
+		var density, gradientSq float32
+		var gradientI Vector2
+		w.forEachNeighbour(i, func(j int, r Vector2, dist float32) {
+			density += mass * k.Density.W(dist)
+			if j == i || dist == 0 {
+				return
+			}
+			// Gradient of the constraint with respect to the position of neighbour j, and its contribution to the gradient
+			// with respect to particle i itself.
+			gradient := r.Scale(k.Pressure.Gradient(dist) / dist * mass / restDensity)
+			gradientI = gradientI.Add(gradient)
+			gradientSq += gradient.LengthSqr()
+		})
+		// Boundary particles do not move, so they only contribute to the gradient with respect to particle i.
+		w.forEachBoundaryNeighbour(i, func(b int, r Vector2, dist float32) {
+			density += w.boundaryMass[b] * k.Density.W(dist)
+			if dist != 0 {
+				gradientI = gradientI.Add(r.Scale(k.Pressure.Gradient(dist) / dist * w.boundaryMass[b] / restDensity))
+			}
+		})
+		gradientSq += gradientI.LengthSqr()
+		w.Particles[i].Density = density
+		w.lambdaScale[i] = 1 / (gradientSq + relaxation)
+		w.lambda[i] = -(density/restDensity - 1) * w.lambdaScale[i]
+	}
+}
+
+// computeCorrection calculates the position corrections of the particles to the acceleration buffer.
+func (s PBF) computeCorrection(w *World, k Kernels) {
+	mass := w.Parameters.ParticleMass
+	restDensity := w.Parameters.RestDensity
+	deltaQW := k.Density.W(s.CorrectionDeltaQ * w.Parameters.SmoothingRadius)
+	for i := range w.Particles {
+		var correction Vector2
+		w.forEachNeighbour(i, func(j int, r Vector2, dist float32) {
+			if j == i || dist == 0 {
+				return
+			}
+			var sCorr float32
+			if s.CorrectionK != 0 && deltaQW > 0 {
+				// Average scale of both particles keeps the correction symmetric.
+				scale := (w.lambdaScale[i] + w.lambdaScale[j]) / 2
+				sCorr = -s.CorrectionK * float32(math.Pow(float64(k.Density.W(dist)/deltaQW), float64(s.CorrectionN))) * scale
+			}
+			gradient := r.Scale(k.Pressure.Gradient(dist) / dist)
+			correction = correction.Add(gradient.Scale(w.lambda[i] + w.lambda[j] + sCorr))
+		})
+		correction = correction.Scale(mass / restDensity)
+		w.forEachBoundaryNeighbour(i, func(b int, r Vector2, dist float32) {
+			if dist != 0 {
+				gradient := r.Scale(k.Pressure.Gradient(dist) / dist)
+				correction = correction.Add(gradient.Scale(w.lambda[i] * w.boundaryMass[b] / restDensity))
+			}
+		})
+		w.acceleration[i] = correction
+	}
+}
+
+// applyVorticityConfinement adds the acceleration ε (N × ω) to the velocities, where ω is the vorticity and N points
+// towards increasing vorticity. In 2D vorticity is a scalar around the axis perpendicular to the plane.
+func (s PBF) applyVorticityConfinement(w *World, k Kernels, dt float32) {
+	if s.VorticityConfinement == 0 {
+		return
+	}
+	mass := w.Parameters.ParticleMass
+	for i := range w.Particles {
+		pi := &w.Particles[i]
+		var vorticity float32
+		w.forEachNeighbour(i, func(j int, r Vector2, dist float32) {
+			if j == i || dist == 0 {
+				return
+			}
+			pj := &w.Particles[j]
+			gradient := r.Scale(k.Pressure.Gradient(dist) / dist)
+			vorticity += mass / pj.Density * gradient.CrossProduct(pj.Velocity.Subtract(pi.Velocity))
+		})
+		w.vorticity[i] = vorticity
+	}
+	for i := range w.Particles {
+		var eta Vector2
+		magnitude := abs(w.vorticity[i])
+		w.forEachNeighbour(i, func(j int, r Vector2, dist float32) {
+			if j == i || dist == 0 {
+				return
+			}
+			gradient := r.Scale(k.Pressure.Gradient(dist) / dist)
+			eta = eta.Add(gradient.Scale(mass / w.Particles[j].Density * (abs(w.vorticity[j]) - magnitude)))
+		})
+		// Location vector N is undefined where vorticity does not change.
+		length := eta.Length()
+		if length < 1e-6 {
+			w.acceleration[i] = Vector2{}
+			continue
+		}
+		normal := eta.Scale(1 / length)
+		w.acceleration[i] = Vector2{X: normal.Y * w.vorticity[i], Y: -normal.X * w.vorticity[i]}.Scale(s.VorticityConfinement)
+	}
+	for i := range w.Particles {
+		p := &w.Particles[i]
+		p.Velocity = p.Velocity.Add(w.acceleration[i].Scale(dt))
+	}
+}
+
+func (s PBF) applyXSPH(w *World, k Kernels) {
+	if s.XSPH.Epsilon == 0 {
+		return
+	}
+	for i := range w.Particles {
+		var correction Vector2
+		w.forEachNeighbour(i, func(j int, r Vector2, dist float32) {
+			if j != i {
+				correction = correction.Add(s.XSPH.VelocityCorrection(w.pair(i, j, r, dist, k)))
+			}
+		})
+		w.acceleration[i] = correction
+	}
+	for i := range w.Particles {
+		w.Particles[i].Velocity = w.Particles[i].Velocity.Add(w.acceleration[i])
+	}
+}
+
+func abs(x float32) float32 {
+	return float32(math.Abs(float64(x)))
+}
+
+// resize returns s with length n, reusing its memory when possible.
+func resize[T any](s []T, n int) []T {
+	if cap(s) < n {
+		return make([]T, n)
+	}
+	return s[:n]
+}
@@ -0,0 +1,84 @@
+package simulation_test
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/MatiasLyyra/fluid/simulation"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPBFFreeFall(t *testing.T) {
+	params := simulation.DefaultParameters()
+	params.Solver = simulation.DefaultPBF()
+	world := simulation.NewWorld(params, []simulation.Particle{{Position: simulation.Vector2{X: 0.5, Y: 0.5}}})
+	for range 100 {
+		world.Step(1e-3)
+	}
+	p := world.Particles[0]
+	// Velocity is recalculated from the change of the position each step, which loses precision in float32.
+	assert.InDelta(t, params.Gravity.Y*0.1, p.Velocity.Y, 1e-3)
+	assert.InDelta(t, 0.5+0.5*params.Gravity.Y*0.1*0.1, p.Position.Y, 1e-3)
+	assert.Zero(t, p.Velocity.X)
+}
+
+// Compressed block of fluid expands back to rest density without blowing up with a time step 50 times larger than the
+// one used for WCSPH.
+func TestPBFLargeTimeStep(t *testing.T) {
+	params := simulation.DefaultParameters()
+	params.Gravity = simulation.Vector2{}
+	params.Solver = simulation.DefaultPBF()
+	const side = 20
+	particles := gridParticles(params, side)
+	for i := range particles {
+		particles[i].Position = particles[i].Position.Scale(0.9).Add(simulation.Vector2{X: 0.4, Y: 0.4})
+	}
+	world := simulation.NewWorld(params, particles)
+	for range 100 {
+		world.Step(5e-3)
+	}
+	for _, p := range world.Particles {
+		assert.False(t, math.IsNaN(float64(p.Position.X)) || math.IsNaN(float64(p.Position.Y)))
+		assert.Less(t, p.Velocity.Length(), float32(1))
+	}
+	center := world.Particles[side/2*side+side/2]
+	assert.InEpsilon(t, params.RestDensity, center.Density, 0.1)
+}
+
+func TestPBFConservesMomentum(t *testing.T) {
+	params := simulation.DefaultParameters()
+	params.Gravity = simulation.Vector2{}
+	pbf := simulation.DefaultPBF()
+	// Vorticity confinement is not symmetric between particles, so it does not conserve momentum.
+	pbf.VorticityConfinement = 0
+	params.Solver = pbf
+	r := rand.New(rand.NewSource(0))
+	particles := gridParticles(params, 16)
+	for i := range particles {
+		particles[i].Velocity = simulation.Vector2{X: r.Float32() - 0.5, Y: r.Float32() - 0.5}
+	}
+	world := simulation.NewWorld(params, particles)
+	initial, _ := momentumAndEnergy(world)
+	for range 10 {
+		world.Step(2e-3)
+	}
+	momentum, _ := momentumAndEnergy(world)
+	assert.InDelta(t, initial.X, momentum.X, 1e-5)
+	assert.InDelta(t, initial.Y, momentum.Y, 1e-5)
+}
+
+func TestWorldSolverSelectableAtRuntime(t *testing.T) {
+	params := simulation.DefaultParameters()
+	world := simulation.NewWorld(params, gridParticles(params, 10))
+	world.Step(1e-4)
+	assert.NotZero(t, world.Particles[0].Pressure)
+
+	world.Parameters.Solver = simulation.DefaultPBF()
+	world.Step(1e-3)
+	assert.Zero(t, world.Particles[0].Pressure)
+
+	world.Parameters.Solver = simulation.WCSPH{}
+	world.Step(1e-4)
+	assert.NotZero(t, world.Particles[0].Pressure)
+}
@@ -0,0 +1,81 @@
+package simulation
+
+// Pair is a particle I and its neighbour J within the smoothing radius.
+type Pair struct {
+	I, J *Particle
+	// Offset from J to I and its length.
+	Offset   Vector2
+	Distance float32
+	// Mass of a particle.
+	Mass float32
+	// Smoothing radius h.
+	SmoothingRadius float32
+	Kernels         Kernels
+}
+
+// ViscosityModel damps the relative motion of neighbouring particles.
+type ViscosityModel interface {
+	// Acceleration returns the acceleration of particle I caused by particle J.
+	Acceleration(p Pair) Vector2
+}
+
+// VelocityFilter is implemented by viscosity models that correct the velocities directly instead of or in addition to
+// applying forces. Corrections are calculated from the velocities after applying the accelerations.
+type VelocityFilter interface {
+	// VelocityCorrection returns the correction to the velocity of particle I caused by particle J.
+	VelocityCorrection(p Pair) Vector2
+}
+
+// LaplacianViscosity is the physical viscosity of a Newtonian fluid, μ∇²v, discretized with the Laplacian of the
+// viscosity kernel as in Müller et al. Suited for laminar flows.
+type LaplacianViscosity struct {
+	// Dynamic viscosity μ.
+	Viscosity float32
+}
+
+func (v LaplacianViscosity) Acceleration(p Pair) Vector2 {
+	relative := p.J.Velocity.Subtract(p.I.Velocity)
+	return relative.Scale(v.Viscosity / p.I.Density * p.Mass / p.J.Density * p.Kernels.Viscosity.Laplacian(p.Distance))
+}
+
+// ArtificialViscosity is the artificial viscosity of Monaghan, which only acts between approaching particles. It keeps
+// splashing and impacts stable with little damping elsewhere.
+type ArtificialViscosity struct {
+	// Alpha is the linear viscosity coefficient, typically between 0.01 and 0.1.
+	Alpha float32
+	// Beta is the quadratic coefficient damping shocks, often zero for fluids.
+	Beta float32
+	// SoundSpeed is the speed of sound c of the fluid.
+	SoundSpeed float32
+}
+
+func (v ArtificialViscosity) Acceleration(p Pair) Vector2 {
+	vr := p.I.Velocity.Subtract(p.J.Velocity).DotProduct(p.Offset)
+	if vr >= 0 || p.Distance == 0 {
+		return Vector2{}
+	}
+	h := p.SmoothingRadius
+	// Small term in the denominator keeps mu finite for nearly coincident particles.
+	mu := h * vr / (p.Distance*p.Distance + 0.01*h*h)
+	density := (p.I.Density + p.J.Density) / 2
+	pi := (-v.Alpha*v.SoundSpeed*mu + v.Beta*mu*mu) / density
+	gradient := p.Offset.Scale(p.Kernels.Pressure.Gradient(p.Distance) / p.Distance)
+	return gradient.Scale(-p.Mass * pi)
+}
+
+// XSPH is the XSPH velocity correction of Monaghan, which blends the velocity of each particle towards the average of
+// its neighbours. It smooths the flow visually without changing the momentum.
+type XSPH struct {
+	// Epsilon is the blending factor between 0 and 1, typically around 0.01 to 0.5.
+	Epsilon float32
+}
+
+func (v XSPH) Acceleration(Pair) Vector2 {
+	return Vector2{}
+}
+
+func (v XSPH) VelocityCorrection(p Pair) Vector2 {
+	relative := p.J.Velocity.Subtract(p.I.Velocity)
+	density := (p.I.Density + p.J.Density) / 2
+	return relative.Scale(v.Epsilon * p.Mass / density * p.Kernels.Density.W(p.Distance))
+}
@@ -0,0 +1,130 @@
+package simulation_test
+
+import (
+	"testing"
+
+	"github.com/MatiasLyyra/fluid/simulation"
+	"github.com/MatiasLyyra/fluid/simulation/kernel"
+	"github.com/stretchr/testify/assert"
+)
+
+// shearWorld returns world of particles on a grid without pressure or gravity, where the upper half moves right and the
+// lower half left.
+func shearWorld(model simulation.ViscosityModel) *simulation.World {
+	params := simulation.DefaultParameters()
+	params.Gravity = simulation.Vector2{}
+	params.EquationOfState = simulation.LinearEOS{}
+	params.Viscosity = model
+	const side = 16
+	particles := gridParticles(params, side)
+	for i := range particles {
+		if i/side >= side/2 {
+			particles[i].Velocity.X = 1
+		} else {
+			particles[i].Velocity.X = -1
+		}
+	}
+	return simulation.NewWorld(params, particles)
+}
+
+func momentumAndEnergy(w *simulation.World) (simulation.Vector2, float32) {
+	var momentum simulation.Vector2
+	var energy float32
+	for _, p := range w.Particles {
+		momentum = momentum.Add(p.Velocity.Scale(w.Parameters.ParticleMass))
+		energy += w.Parameters.ParticleMass * p.Velocity.LengthSqr() / 2
+	}
+	return momentum, energy
+}
+
+func TestViscosityModelsDampShearFlow(t *testing.T) {
+	models := map[string]simulation.ViscosityModel{
+		"Laplacian":  simulation.LaplacianViscosity{Viscosity: 1},
+		"artificial": simulation.ArtificialViscosity{Alpha: 0.1, SoundSpeed: 20},
+		"XSPH":       simulation.XSPH{Epsilon: 0.1},
+	}
+	for name, model := range models {
+		t.Run(name, func(t *testing.T) {
+			w := shearWorld(model)
+			_, initialEnergy := momentumAndEnergy(w)
+			for range 10 {
+				w.Step(1e-4)
+			}
+			momentum, energy := momentumAndEnergy(w)
+			assert.InDelta(t, 0, momentum.X, 1e-6)
+			assert.InDelta(t, 0, momentum.Y, 1e-6)
+			assert.Less(t, energy, initialEnergy)
+		})
+	}
+	t.Run("inviscid", func(t *testing.T) {
+		w := shearWorld(nil)
+		_, initialEnergy := momentumAndEnergy(w)
+		for range 10 {
+			w.Step(1e-4)
+		}
+		_, energy := momentumAndEnergy(w)
+		assert.InEpsilon(t, initialEnergy, energy, 1e-6)
+	})
+}
+
+func TestLaplacianViscosityDampsShearBetweenLayers(t *testing.T) {
+	slow := shearWorld(simulation.LaplacianViscosity{Viscosity: 1})
+	fast := shearWorld(simulation.LaplacianViscosity{Viscosity: 2})
+	slow.Step(1e-4)
+	fast.Step(1e-4)
+	// Particles next to the interface are decelerated, twice as much with twice the viscosity.
+	const above = 8*16 + 8
+	assert.Less(t, slow.Particles[above].Velocity.X, float32(1))
+	assert.InEpsilon(t, 2*(1-slow.Particles[above].Velocity.X), 1-fast.Particles[above].Velocity.X, 1e-3)
+	// Shear does not leak to the layers further away than the smoothing radius.
+	assert.Equal(t, float32(1), slow.Particles[15*16+8].Velocity.X)
+}
+
+func testPair(vi, vj simulation.Vector2, offset simulation.Vector2) simulation.Pair {
+	params := simulation.DefaultParameters()
+	h := params.SmoothingRadius
+	return simulation.Pair{
+		I:               &simulation.Particle{Velocity: vi, Density: params.RestDensity},
+		J:               &simulation.Particle{Velocity: vj, Density: params.RestDensity},
+		Offset:          offset,
+		Distance:        offset.Length(),
+		Mass:            params.ParticleMass,
+		SmoothingRadius: h,
+		Kernels: simulation.Kernels{
+			Density:   kernel.New(kernel.Poly6, h, kernel.Dim2),
+			Pressure:  kernel.New(kernel.Spiky, h, kernel.Dim2),
+			Viscosity: kernel.New(kernel.Viscosity, h, kernel.Dim2),
+		},
+	}
+}
+
+func TestArtificialViscosityActsOnApproachingParticles(t *testing.T) {
+	model := simulation.ArtificialViscosity{Alpha: 0.1, Beta: 0.2, SoundSpeed: 20}
+	offset := simulation.Vector2{X: 0.005}
+
+	// I is right of J and moves towards it, so it is pushed back right.
+	approaching := model.Acceleration(testPair(simulation.Vector2{X: -1}, simulation.Vector2{X: 1}, offset))
+	assert.Positive(t, approaching.X)
+	assert.Zero(t, approaching.Y)
+
+	separating := model.Acceleration(testPair(simulation.Vector2{X: 1}, simulation.Vector2{X: -1}, offset))
+	assert.Zero(t, separating)
+
+	// Motion perpendicular to the offset does not approach.
+	shear := model.Acceleration(testPair(simulation.Vector2{Y: 1}, simulation.Vector2{Y: -1}, offset))
+	assert.Zero(t, shear)
+}
+
+func TestXSPHBlendsVelocities(t *testing.T) {
+	model := simulation.XSPH{Epsilon: 0.5}
+	offset := simulation.Vector2{Y: 0.005}
+	pair := testPair(simulation.Vector2{X: 1}, simulation.Vector2{X: -1}, offset)
+	correction := model.VelocityCorrection(pair)
+	assert.Negative(t, correction.X)
+	assert.Zero(t, correction.Y)
+	assert.Zero(t, model.Acceleration(pair))
+
+	// Correction of J is opposite, so momentum is conserved.
+	reverse := model.VelocityCorrection(testPair(simulation.Vector2{X: -1}, simulation.Vector2{X: 1}, offset.Negate()))
+	assert.Equal(t, correction.Negate(), reverse)
+}
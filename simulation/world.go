@@ -0,0 +1,277 @@
+package simulation
+
+import (
+	"math"
+
+	"github.com/MatiasLyyra/fluid/simulation/kernel"
+)
+
+// Parameters of the fluid and the simulation.
+type Parameters struct {
+	// Density of the fluid at rest.
+	RestDensity float32
+	// EquationOfState calculates the pressure from the density.
+	EquationOfState EquationOfState
+	// Viscosity model damping the relative motion of the particles, or nil for an inviscid fluid.
+	Viscosity ViscosityModel
+	// Gravitational acceleration.
+	Gravity Vector2
+	// Smoothing radius h of the kernels. Particles further apart do not interact.
+	SmoothingRadius float32
+	// Domain of the neighbour search grid and the walls. Without walls particles outside the domain are simulated, but
+	// searching their neighbours is slower.
+	DomainMin, DomainMax Vector2
+	// Mass of a single particle.
+	ParticleMass float32
+	// Kernels used for density, pressure gradient and viscosity Laplacian.
+	DensityKernel, PressureKernel, ViscosityKernel kernel.Type
+	// Walls keeping the particles inside the domain, or nil to let particles leave the domain.
+	Walls *Walls
+	// Solver advancing the simulation, or nil for WCSPH. Solver can be changed between steps.
+	Solver Solver
+}
+
+// DefaultParameters returns parameters for a water-like fluid in a domain of about one unit, with particles spaced half
+// of the smoothing radius apart.
+func DefaultParameters() Parameters {
+	const h = 0.01
+	const restDensity = 1000
+	return Parameters{
+		RestDensity:     restDensity,
+		EquationOfState: LinearEOS{Stiffness: 1000},
+		Viscosity:       LaplacianViscosity{Viscosity: 1},
+		Gravity:         Vector2{X: 0, Y: -9.81},
+		SmoothingRadius: h,
+		DomainMin:       Vector2{X: 0, Y: 0},
+		DomainMax:       Vector2{X: 1, Y: 1},
+		ParticleMass:    restDensity * (h / 2) * (h / 2),
+		DensityKernel:   kernel.Poly6,
+		PressureKernel:  kernel.Spiky,
+		ViscosityKernel: kernel.Viscosity,
+	}
+}
+
+// ParticleSpacing returns the distance between particles on a square grid at rest density.
+func (p Parameters) ParticleSpacing() float32 {
+	return float32(math.Sqrt(float64(p.ParticleMass / p.RestDensity)))
+}
+
+// Kernels are the smoothing kernels of a world.
+type Kernels struct {
+	Density, Pressure, Viscosity kernel.Kernel
+}
+
+// World is a 2D fluid simulated with smoothed particle hydrodynamics.
+type World struct {
+	Particles  []Particle
+	Parameters Parameters
+
+	acceleration []Vector2
+	// Positions at the start of the step, density constraint factors and their scales, and vorticities used by PBF.
+	previous    []Vector2
+	lambda      []float32
+	lambdaScale []float32
+	vorticity   []float32
+	// Pressure solve terms and statistics of the last step of IISPH.
+	iisph       iisphBuffers
+	convergence ConvergenceStats
+	search      *NeighbourSearch
+	// Parameters the search was created with.
+	searchMin, searchMax Vector2
+	searchRadius         float32
+	overflow             int
+	// Static boundary particles, their neighbour search and the fluid mass Ψ each of them represents.
+	boundary       []Particle
+	boundarySearch *NeighbourSearch
+	boundaryMass   []float32
+	// Parameters the boundary masses were calculated with, or nil if they have not been calculated.
+	boundaryMassParameters *boundaryMassParameters
+}
+
+// NewWorld creates world simulating particles with params.
+func NewWorld(params Parameters, particles []Particle) *World {
+	return &World{
+		Particles:    particles,
+		Parameters:   params,
+		acceleration: make([]Vector2, len(particles)),
+	}
+}
+
+// Solver advances World by a single step.
+type Solver interface {
+	step(w *World, dt float32, k Kernels)
+}
+
+// WCSPH is the weakly compressible SPH solver, where pressure is calculated from the density by the equation of state
+// and the particles are moved by the pressure and viscosity forces.
+type WCSPH struct{}
+
+func (WCSPH) step(w *World, dt float32, k Kernels) {
+	w.findNeighbours()
+	w.computeDensity(k.Density)
+	w.computePressure()
+	w.computeAcceleration(k)
+	w.integrate(dt, k)
+}
+
+// Step advances the simulation by dt seconds.
+func (w *World) Step(dt float32) {
+	if len(w.acceleration) != len(w.Particles) {
+		w.acceleration = make([]Vector2, len(w.Particles))
+	}
+	h := w.Parameters.SmoothingRadius
+	k := Kernels{
+		Density:   kernel.New(w.Parameters.DensityKernel, h, kernel.Dim2),
+		Pressure:  kernel.New(w.Parameters.PressureKernel, h, kernel.Dim2),
+		Viscosity: kernel.New(w.Parameters.ViscosityKernel, h, kernel.Dim2),
+	}
+	solver := w.Parameters.Solver
+	if solver == nil {
+		solver = WCSPH{}
+	}
+	w.updateBoundary(k)
+	solver.step(w, dt, k)
+	w.applyWalls()
+}
+
+// findNeighbours finds the neighbours of the particles at their current positions.
+func (w *World) findNeighbours() {
+	h := w.Parameters.SmoothingRadius
+	if w.search == nil || w.searchMin != w.Parameters.DomainMin || w.searchMax != w.Parameters.DomainMax || w.searchRadius != h {
+		w.search = NewNeighbourSearch(w.Parameters.DomainMin, w.Parameters.DomainMax, h)
+		w.searchMin, w.searchMax, w.searchRadius = w.Parameters.DomainMin, w.Parameters.DomainMax, h
+	}
+	w.overflow = w.search.Find(w.Particles)
+}
+
+func (w *World) pair(i, j int, r Vector2, dist float32, k Kernels) Pair {
+	return Pair{
+		I:               &w.Particles[i],
+		J:               &w.Particles[j],
+		Offset:          r,
+		Distance:        dist,
+		Mass:            w.Parameters.ParticleMass,
+		SmoothingRadius: w.Parameters.SmoothingRadius,
+		Kernels:         k,
+	}
+}
+
+// NeighbourOverflow returns the count of neighbours left out of the last step, because particles had more than
+// MaxNeighbours neighbours.
+func (w *World) NeighbourOverflow() int {
+	return w.overflow
+}
+
+// Convergence returns the statistics of the pressure solve of the last step. Only IISPH solves the pressures
+// iteratively, so the statistics are zero for other solvers.
+func (w *World) Convergence() ConvergenceStats {
+	return w.convergence
+}
+
+// forEachNeighbour calls fn for each neighbour j of particle i found by the last findNeighbours, including i itself,
+// with the offset from j to i and its length.
+func (w *World) forEachNeighbour(i int, fn func(j int, r Vector2, dist float32)) {
+	pi := w.Particles[i].Position
+	for _, j := range w.search.List().Neighbours(i) {
+		r := pi.Subtract(w.Particles[j].Position)
+		fn(int(j), r, r.Length())
+	}
+}
+
+func (w *World) computeDensity(k kernel.Kernel) {
+	mass := w.Parameters.ParticleMass
+	for i := range w.Particles {
+		var density float32
+		w.forEachNeighbour(i, func(j int, r Vector2, dist float32) {
+			density += mass * k.W(dist)
+		})
+		w.forEachBoundaryNeighbour(i, func(b int, r Vector2, dist float32) {
+			density += w.boundaryMass[b] * k.W(dist)
+		})
+		w.Particles[i].Density = density
+	}
+}
+
+func (w *World) computePressure() {
+	for i := range w.Particles {
+		p := &w.Particles[i]
+		p.Pressure = w.Parameters.EquationOfState.Pressure(p.Density, w.Parameters.RestDensity)
+	}
+}
+
+// computeAcceleration calculates the accelerations of the particles due to pressure, viscosity and gravity.
+func (w *World) computeAcceleration(k Kernels) {
+	w.computePressureAcceleration(k)
+	w.addNonPressureAcceleration(k)
+}
+
+// computePressureAcceleration sets the acceleration buffer to the pressure accelerations of the particles.
+func (w *World) computePressureAcceleration(k Kernels) {
+	mass := w.Parameters.ParticleMass
+	for i := range w.Particles {
+		pi := &w.Particles[i]
+		pressureTerm := pi.Pressure / (pi.Density * pi.Density)
+		var pressure Vector2
+		w.forEachNeighbour(i, func(j int, r Vector2, dist float32) {
+			if j == i || dist == 0 {
+				return
+			}
+			pj := &w.Particles[j]
+			gradient := r.Scale(k.Pressure.Gradient(dist) / dist)
+			// Symmetric pressure force conserves momentum between each pair of particles.
+			pressure = pressure.Subtract(gradient.Scale(mass * (pressureTerm + pj.Pressure/(pj.Density*pj.Density))))
+		})
+		// Boundary particles push the fluid away with the pressure of the particle itself.
+		w.forEachBoundaryNeighbour(i, func(b int, r Vector2, dist float32) {
+			if dist == 0 {
+				return
+			}
+			gradient := r.Scale(k.Pressure.Gradient(dist) / dist)
+			pressure = pressure.Subtract(gradient.Scale(w.boundaryMass[b] * pressureTerm))
+		})
+		w.acceleration[i] = pressure
+	}
+}
+
+// addNonPressureAcceleration adds the viscosity and gravity accelerations of the particles to the acceleration buffer.
+func (w *World) addNonPressureAcceleration(k Kernels) {
+	viscosity := w.Parameters.Viscosity
+	for i := range w.Particles {
+		var viscous Vector2
+		if viscosity != nil {
+			w.forEachNeighbour(i, func(j int, r Vector2, dist float32) {
+				if j != i && dist != 0 {
+					viscous = viscous.Add(viscosity.Acceleration(w.pair(i, j, r, dist, k)))
+				}
+			})
+		}
+		w.acceleration[i] = w.acceleration[i].Add(viscous).Add(w.Parameters.Gravity)
+	}
+}
+
+func (w *World) integrate(dt float32, k Kernels) {
+	for i := range w.Particles {
+		p := &w.Particles[i]
+		p.Velocity = p.Velocity.Add(w.acceleration[i].Scale(dt))
+	}
+	if filter, ok := w.Parameters.Viscosity.(VelocityFilter); ok {
+		// Accelerations are no longer needed, so their buffer holds the corrections until all have been calculated.
+		corrections := w.acceleration
+		for i := range w.Particles {
+			var correction Vector2
+			w.forEachNeighbour(i, func(j int, r Vector2, dist float32) {
+				if j != i {
+					correction = correction.Add(filter.VelocityCorrection(w.pair(i, j, r, dist, k)))
+				}
+			})
+			corrections[i] = correction
+		}
+		for i := range w.Particles {
+			w.Particles[i].Velocity = w.Particles[i].Velocity.Add(corrections[i])
+		}
+	}
+	for i := range w.Particles {
+		p := &w.Particles[i]
+		p.Position = p.Position.Add(p.Velocity.Scale(dt))
+	}
+}
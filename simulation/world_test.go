@@ -0,0 +1,73 @@
+package simulation_test
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/MatiasLyyra/fluid/simulation"
+	"github.com/stretchr/testify/assert"
+)
+
+// gridParticles returns particles at rest on a side×side grid with the spacing of params.
+func gridParticles(params simulation.Parameters, side int) []simulation.Particle {
+	spacing := params.ParticleSpacing()
+	particles := make([]simulation.Particle, 0, side*side)
+	for y := range side {
+		for x := range side {
+			particles = append(particles, simulation.Particle{Position: simulation.Vector2{X: float32(x) * spacing, Y: float32(y) * spacing}})
+		}
+	}
+	return particles
+}
+
+func TestWorldFreeFall(t *testing.T) {
+	params := simulation.DefaultParameters()
+	world := simulation.NewWorld(params, []simulation.Particle{{Position: simulation.Vector2{X: 0.5, Y: 0.5}}})
+	for range 100 {
+		world.Step(1e-3)
+	}
+	p := world.Particles[0]
+	assert.InDelta(t, params.Gravity.Y*0.1, p.Velocity.Y, 1e-4)
+	assert.InDelta(t, 0.5+0.5*params.Gravity.Y*0.1*0.1, p.Position.Y, 1e-3)
+	assert.Zero(t, p.Velocity.X)
+}
+
+func TestWorldRestDensity(t *testing.T) {
+	params := simulation.DefaultParameters()
+	const side = 20
+	world := simulation.NewWorld(params, gridParticles(params, side))
+	world.Step(0)
+
+	// Particles far enough from the edges have a full neighbourhood.
+	center := world.Particles[side/2*side+side/2]
+	assert.InEpsilon(t, params.RestDensity, center.Density, 0.1)
+}
+
+func TestWorldConservesMomentum(t *testing.T) {
+	params := simulation.DefaultParameters()
+	params.Gravity = simulation.Vector2{}
+	particles := gridParticles(params, 10)
+	r := rand.New(rand.NewSource(0))
+	for i := range particles {
+		particles[i].Position = particles[i].Position.Add(simulation.Vector2{X: r.Float32(), Y: r.Float32()}.Scale(params.ParticleSpacing() * 0.5))
+		particles[i].Velocity = simulation.Vector2{X: r.Float32() - 0.5, Y: r.Float32() - 0.5}
+	}
+	world := simulation.NewWorld(params, particles)
+
+	momentum := func() simulation.Vector2 {
+		var sum simulation.Vector2
+		for _, p := range world.Particles {
+			sum = sum.Add(p.Velocity.Scale(params.ParticleMass))
+		}
+		return sum
+	}
+	before := momentum()
+	for range 10 {
+		world.Step(1e-4)
+	}
+	after := momentum()
+	assert.InDelta(t, before.X, after.X, 1e-4)
+	assert.InDelta(t, before.Y, after.Y, 1e-4)
+	assert.False(t, math.IsNaN(float64(after.X)))
+}